@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+const (
+	// ServiceIPAnnotation requests specific LoadBalancer IPs for a Service. Multiple IPs of different
+	// IP families are separated by commas. It takes precedence over spec.loadBalancerIP.
+	ServiceIPAnnotation = "metal-loadbalancer.ironcore.dev/ip"
+
+	// ServiceNodeSelectorAnnotation restricts the nodes announcing a Service to those matching the given
+	// label selector, e.g. "node-role.kubernetes.io/edge". It overrides the node selector of the speaker.
+	ServiceNodeSelectorAnnotation = "metal-loadbalancer.ironcore.dev/node-selector"
+
+	// ServiceVNIAnnotation announces the routes of a Service in the given VNI instead of the default VNI
+	// of the speaker.
+	ServiceVNIAnnotation = "metal-loadbalancer.ironcore.dev/vni"
+
+	// ServiceNextHopTypeAnnotation sets the NextHopType the IPs of a Service are announced with. It overrides
+	// the next hop of the LoadBalancerIPPool.
+	ServiceNextHopTypeAnnotation = "metal-loadbalancer.ironcore.dev/next-hop-type"
+
+	// ServiceNATPortRangeAnnotation sets the port range of NAT next hops as "<from>-<to>".
+	ServiceNATPortRangeAnnotation = "metal-loadbalancer.ironcore.dev/nat-port-range"
+)
+
+const (
+	// ServiceIPConflictCondition reports whether an IP of the Service is already in use by another Service.
+	ServiceIPConflictCondition = "IPConflict"
+
+	// ServiceIPAllocatedCondition reports whether the controller allocated the LoadBalancer IPs of the Service.
+	ServiceIPAllocatedCondition = "IPAllocated"
+
+	// ServiceAnnouncedCondition reports whether at least one node announces the routes of the Service.
+	ServiceAnnouncedCondition = "Announced"
+
+	// ServiceAnnouncementFailedCondition reports whether a node failed to announce the routes of the Service.
+	// The message names the failing node.
+	ServiceAnnouncementFailedCondition = "AnnouncementFailed"
+)
+
+// NextHopType is the type of the next hop addresses are announced with.
+// +kubebuilder:validation:Enum=Standard;NAT;LoadBalancerTarget
+type NextHopType string
+
+const (
+	// NextHopTypeStandard forwards traffic to the node.
+	NextHopTypeStandard NextHopType = "Standard"
+	// NextHopTypeNAT forwards traffic of the NAT port range to the node.
+	NextHopTypeNAT NextHopType = "NAT"
+	// NextHopTypeLoadBalancerTarget announces the node as load balancer target.
+	NextHopTypeLoadBalancerTarget NextHopType = "LoadBalancerTarget"
+)
+
+// NextHop defines how addresses are announced.
+// +kubebuilder:validation:XValidation:rule="self.type != 'NAT' || has(self.natPortRange)",message="natPortRange is required for NAT next hops"
+type NextHop struct {
+	// Type is the type of the next hop.
+	// +kubebuilder:default=Standard
+	// +optional
+	Type NextHopType `json:"type,omitempty"`
+
+	// NATPortRange is the port range of NAT next hops.
+	// +optional
+	NATPortRange *PortRange `json:"natPortRange,omitempty"`
+}
+
+// PortRange is a range of ports.
+// +kubebuilder:validation:XValidation:rule="self.from <= self.to",message="from must not be greater than to"
+type PortRange struct {
+	// From is the first port of the range.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	From int32 `json:"from"`
+
+	// To is the last port of the range.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	To int32 `json:"to"`
+}
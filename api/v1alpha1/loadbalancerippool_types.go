@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// AllocationOrder defines in which order addresses are handed out from a LoadBalancerIPPool.
+// +kubebuilder:validation:Enum=Ascending;Descending
+type AllocationOrder string
+
+const (
+	// AllocationOrderAscending hands out the lowest free address first.
+	AllocationOrderAscending AllocationOrder = "Ascending"
+	// AllocationOrderDescending hands out the highest free address first.
+	AllocationOrderDescending AllocationOrder = "Descending"
+)
+
+// LoadBalancerIPPoolSpec defines the desired state of LoadBalancerIPPool
+type LoadBalancerIPPoolSpec struct {
+	// CIDRs are the address ranges LoadBalancer IPs are allocated from.
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=128
+	// +kubebuilder:validation:items:MaxLength=43
+	// +kubebuilder:validation:XValidation:rule="self.all(c, isCIDR(c))",message="cidrs must be valid CIDRs"
+	// +listType=set
+	CIDRs []string `json:"cidrs"`
+
+	// Exclusions are addresses or CIDRs within CIDRs that are never allocated.
+	// +kubebuilder:validation:MaxItems=1024
+	// +kubebuilder:validation:items:MaxLength=43
+	// +kubebuilder:validation:XValidation:rule="self.all(e, isIP(e) || isCIDR(e))",message="exclusions must be valid IPs or CIDRs"
+	// +listType=set
+	// +optional
+	Exclusions []string `json:"exclusions,omitempty"`
+
+	// AllocationOrder defines whether the lowest or the highest free address is allocated first.
+	// +kubebuilder:default=Ascending
+	// +optional
+	AllocationOrder AllocationOrder `json:"allocationOrder,omitempty"`
+
+	// NextHop defines how the addresses of this pool are announced. If unset, standard next hops are used.
+	// +optional
+	NextHop *NextHop `json:"nextHop,omitempty"`
+
+	// Aggregate announces the CIDRs of this pool instead of a route per Service. Services that need a different
+	// next hop, VNI or set of announcing nodes are still announced with more-specific routes, and their addresses
+	// are carved out of the aggregated prefixes.
+	// +optional
+	Aggregate bool `json:"aggregate,omitempty"`
+}
+
+// LoadBalancerIPPoolStatus defines the observed state of LoadBalancerIPPool
+type LoadBalancerIPPoolStatus struct {
+	// Allocations are the addresses currently allocated from this pool.
+	// +listType=map
+	// +listMapKey=ip
+	// +optional
+	Allocations []IPAllocation `json:"allocations,omitempty"`
+}
+
+// IPAllocation records an address handed out to a Service.
+type IPAllocation struct {
+	// IP is the allocated address.
+	IP string `json:"ip"`
+	// ServiceRef references the Service the address is allocated to.
+	ServiceRef ServiceReference `json:"serviceRef"`
+}
+
+// ServiceReference references a Service.
+type ServiceReference struct {
+	// Namespace is the namespace of the Service.
+	Namespace string `json:"namespace"`
+	// Name is the name of the Service.
+	Name string `json:"name"`
+	// UID is the UID of the Service.
+	UID types.UID `json:"uid"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="CIDRs",type=string,JSONPath=`.spec.cidrs`
+// +kubebuilder:printcolumn:name="Order",type=string,JSONPath=`.spec.allocationOrder`
+// +kubebuilder:printcolumn:name="Aggregate",type=boolean,JSONPath=`.spec.aggregate`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// LoadBalancerIPPool is the Schema for the loadbalancerippools API
+type LoadBalancerIPPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   LoadBalancerIPPoolSpec   `json:"spec,omitempty"`
+	Status LoadBalancerIPPoolStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// LoadBalancerIPPoolList contains a list of LoadBalancerIPPool
+type LoadBalancerIPPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LoadBalancerIPPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&LoadBalancerIPPool{}, &LoadBalancerIPPoolList{})
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ServiceAnnouncementSpec defines the desired state of ServiceAnnouncement
+type ServiceAnnouncementSpec struct {
+	// ServiceRef references the announced Service.
+	ServiceRef corev1.LocalObjectReference `json:"serviceRef"`
+
+	// NodeName is the name of the announcing node.
+	NodeName string `json:"nodeName"`
+}
+
+// ServiceAnnouncementStatus defines the observed state of ServiceAnnouncement
+type ServiceAnnouncementStatus struct {
+	// Routes are the routes the node announces for the Service.
+	// +listType=atomic
+	// +optional
+	Routes []AnnouncedRoute `json:"routes,omitempty"`
+
+	// Peers are the states of the metalbond sessions of the node.
+	// +listType=map
+	// +listMapKey=server
+	// +optional
+	Peers []PeerStatus `json:"peers,omitempty"`
+
+	// LastAnnouncedTime is the time the routes were last changed.
+	// +optional
+	LastAnnouncedTime *metav1.Time `json:"lastAnnouncedTime,omitempty"`
+}
+
+// AnnouncedRoute is a route announced by a node.
+type AnnouncedRoute struct {
+	// VNI is the VNI the route is announced in.
+	VNI int32 `json:"vni"`
+	// Prefix is the destination of the route.
+	Prefix string `json:"prefix"`
+	// NextHop is the address of the next hop.
+	NextHop string `json:"nextHop"`
+	// NextHopType is the type of the next hop.
+	NextHopType NextHopType `json:"nextHopType"`
+	// NATPortRange is the port range of NAT next hops.
+	// +optional
+	NATPortRange *PortRange `json:"natPortRange,omitempty"`
+}
+
+// PeerStatus is the state of a metalbond session.
+type PeerStatus struct {
+	// Server is the endpoint of the metalbond server.
+	Server string `json:"server"`
+	// State is the state of the session, e.g. ESTABLISHED.
+	State string `json:"state"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Service",type=string,JSONPath=`.spec.serviceRef.name`
+// +kubebuilder:printcolumn:name="Node",type=string,JSONPath=`.spec.nodeName`
+// +kubebuilder:printcolumn:name="LastAnnounced",type=date,JSONPath=`.status.lastAnnouncedTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ServiceAnnouncement is the Schema for the serviceannouncements API. It reports the routes a node announces
+// for a Service and is owned by the Service.
+type ServiceAnnouncement struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ServiceAnnouncementSpec   `json:"spec,omitempty"`
+	Status ServiceAnnouncementStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ServiceAnnouncementList contains a list of ServiceAnnouncement
+type ServiceAnnouncementList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ServiceAnnouncement `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ServiceAnnouncement{}, &ServiceAnnouncementList{})
+}
@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VNIMappingSpec defines the desired state of VNIMapping
+// +kubebuilder:validation:XValidation:rule="has(self.namespaces) || has(self.namespaceSelector)",message="namespaces or namespaceSelector must be set"
+type VNIMappingSpec struct {
+	// Namespaces are the names of the namespaces mapped to the VNI.
+	// +listType=set
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// NamespaceSelector selects the namespaces mapped to the VNI by their labels.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// VNI is the VNI the Services of the namespaces are announced in.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=16777215
+	VNI int32 `json:"vni"`
+
+	// IPPoolRef references the LoadBalancerIPPool the LoadBalancer IPs of the Services of the namespaces
+	// are allocated from. If unset, any LoadBalancerIPPool is used.
+	// +optional
+	IPPoolRef *corev1.LocalObjectReference `json:"ipPoolRef,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="VNI",type=integer,JSONPath=`.spec.vni`
+// +kubebuilder:printcolumn:name="IPPool",type=string,JSONPath=`.spec.ipPoolRef.name`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// VNIMapping is the Schema for the vnimappings API
+type VNIMapping struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec VNIMappingSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VNIMappingList contains a list of VNIMapping
+type VNIMappingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VNIMapping `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VNIMapping{}, &VNIMappingList{})
+}
@@ -7,11 +7,13 @@ import (
 	"crypto/tls"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
 	metalloadbalancercontroller "github.com/ironcore-dev/metal-load-balancer-controller/internal/metal-load-balancer-controller"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -35,6 +37,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(corev1.AddToScheme(scheme))
+	utilruntime.Must(metalloadbalancerv1alpha1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -46,6 +49,20 @@ func main() {
 	var secureMetrics bool
 	var enableHTTP2 bool
 	var tlsOpts []func(*tls.Config)
+
+	var loadBalancerClass string
+	var includeServicesWithoutClass bool
+	var allocationGCInterval time.Duration
+
+	flag.StringVar(&loadBalancerClass, "load-balancer-class", "",
+		"Only handle Services with this spec.loadBalancerClass. If empty, only Services without a class are handled.")
+	flag.BoolVar(&includeServicesWithoutClass, "include-services-without-class", false,
+		"If set, Services without spec.loadBalancerClass are handled in addition to the ones of --load-balancer-class.")
+
+	flag.DurationVar(&allocationGCInterval, "allocation-gc-interval",
+		metalloadbalancercontroller.DefaultAllocationGCInterval,
+		"The interval in which allocations of deleted Services are released.")
+
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -134,8 +151,13 @@ func main() {
 	}
 
 	if err = (&metalloadbalancercontroller.ServiceReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorder("metal-load-balancer-controller"),
+
+		LoadBalancerClass:           loadBalancerClass,
+		IncludeServicesWithoutClass: includeServicesWithoutClass,
+		AllocationGCInterval:        allocationGCInterval,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Service")
 		os.Exit(1)
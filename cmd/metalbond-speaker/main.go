@@ -4,22 +4,25 @@
 package main
 
 import (
-	"context"
 	"crypto/tls"
 	"flag"
+	"net/netip"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
 	metalbondspeaker "github.com/ironcore-dev/metal-load-balancer-controller/internal/metalbond-speaker"
 	"github.com/ironcore-dev/metalbond"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
@@ -39,6 +42,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(corev1.AddToScheme(scheme))
+	utilruntime.Must(metalloadbalancerv1alpha1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -52,13 +56,50 @@ func main() {
 	var tlsOpts []func(*tls.Config)
 
 	var vni int
-	var metalbondServer string
+	var metalbondServers []string
+	var nodeName string
 	var nodeAddress string
-	var metalbondConnectionTimeout = 20 * time.Second
+	var nodeAddressTypes string
+	var nodeAddressFamily string
+	var routeGCInterval time.Duration
+	var metalbondLivenessGracePeriod time.Duration
+	var gracefulShutdownTimeout time.Duration
+	var loadBalancerClass string
+	var nodeSelector string
+	var includeServicesWithoutClass bool
 
-	flag.IntVar(&vni, "vni", 0, "VNI in which the route announcements should be done.")
-	flag.StringVar(&metalbondServer, "metalbond-server", "", "Endpoint of the metalbond server`")
-	flag.StringVar(&nodeAddress, "node-address", "", "Node address of the manager.")
+	flag.IntVar(&vni, "vni", 0, "Default VNI in which the route announcements should be done.")
+	flag.Func("metalbond-server", "Endpoint of a metalbond server. May be repeated or comma-separated.",
+		func(value string) error {
+			for _, server := range strings.Split(value, ",") {
+				server = strings.TrimSpace(server)
+				if server == "" || slices.Contains(metalbondServers, server) {
+					continue
+				}
+				metalbondServers = append(metalbondServers, server)
+			}
+			return nil
+		})
+	flag.StringVar(&nodeName, "node-name", "", "Name of the node the speaker is running on.")
+	flag.StringVar(&nodeAddress, "node-address", "",
+		"Address announced as next hop. If empty, the address is selected from the status of the node.")
+	flag.StringVar(&nodeAddressTypes, "node-address-types", defaultNodeAddressTypes(),
+		"Comma-separated node address types to select the next hop address from, in order of preference.")
+	flag.StringVar(&nodeAddressFamily, "node-address-family", string(corev1.IPv6Protocol),
+		"IP family of the selected next hop address. If empty, addresses of any family are selected.")
+	flag.DurationVar(&routeGCInterval, "route-gc-interval", metalbondspeaker.DefaultRouteGCInterval,
+		"Interval in which announced routes are compared with the Services and orphaned routes are withdrawn.")
+	flag.DurationVar(&metalbondLivenessGracePeriod, "metalbond-liveness-grace-period", 2*time.Minute,
+		"Duration all metalbond sessions may be down before the liveness probe fails.")
+	flag.DurationVar(&gracefulShutdownTimeout, "graceful-shutdown-timeout", 8*time.Second,
+		"Duration to withdraw all routes on shutdown. Must be shorter than the terminationGracePeriodSeconds of the pod.")
+	flag.StringVar(&nodeSelector, "node-selector", "",
+		"Only announce Services if this node matches the label selector. Services may override it with the "+
+			metalloadbalancerv1alpha1.ServiceNodeSelectorAnnotation+" annotation.")
+	flag.StringVar(&loadBalancerClass, "load-balancer-class", "",
+		"Only handle Services with this spec.loadBalancerClass. If empty, only Services without a class are handled.")
+	flag.BoolVar(&includeServicesWithoutClass, "include-services-without-class", false,
+		"If set, Services without spec.loadBalancerClass are handled in addition to the ones of --load-balancer-class.")
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -79,41 +120,43 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	// create a metalbond client
-	metalbondClient := metalbond.NewDummyClient()
-	config := metalbond.Config{KeepaliveInterval: 5}
-	mb := metalbond.NewMetalBond(config, metalbondClient)
-
-	if nodeAddress == "" {
-		setupLog.Error(nil, "no node address provided")
+	if len(metalbondServers) == 0 {
+		setupLog.Error(nil, "no metalbond server provided")
 		os.Exit(1)
 	}
 
-	if err := mb.AddPeer(metalbondServer, ""); err != nil {
-		setupLog.Error(err, "unable to add metalbond peer")
+	if routeGCInterval <= 0 {
+		setupLog.Error(nil, "route GC interval must be positive")
 		os.Exit(1)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), metalbondConnectionTimeout)
-	defer cancel()
+	// create a metalbond instance per server
+	peers := metalbondspeaker.NewPeers(metalbondServers, metalbond.Config{KeepaliveInterval: 5})
 
-	if err := wait.PollUntilContextTimeout(ctx,
-		1*time.Second,
-		metalbondConnectionTimeout,
-		true,
-		func(context.Context) (bool, error) {
-			state, err := mb.PeerState(metalbondServer)
-			if err != nil {
-				return false, err
-			}
-			return state == metalbond.ESTABLISHED, nil
-		}); err != nil {
-		setupLog.Error(err, "unable to add a metalbond peer", "Server", metalbondServer)
+	if nodeName == "" {
+		setupLog.Error(nil, "no node name provided")
 		os.Exit(1)
 	}
 
-	if err := mb.Subscribe(metalbond.VNI(vni)); err != nil {
-		setupLog.Error(err, "unable to subscribe to metalbond", "VNI", vni)
+	parsedNodeSelector, err := labels.Parse(nodeSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid node selector")
+		os.Exit(1)
+	}
+
+	if nodeAddress != "" {
+		if _, err := netip.ParseAddr(nodeAddress); err != nil {
+			setupLog.Error(err, "invalid node address")
+			os.Exit(1)
+		}
+	}
+
+	nodeAddressSelector := metalbondspeaker.NodeAddressSelector{Family: corev1.IPFamily(nodeAddressFamily)}
+	for _, addressType := range strings.Split(nodeAddressTypes, ",") {
+		nodeAddressSelector.Types = append(nodeAddressSelector.Types, corev1.NodeAddressType(addressType))
+	}
+	if err := nodeAddressSelector.Validate(); err != nil {
+		setupLog.Error(err, "invalid node address selection")
 		os.Exit(1)
 	}
 
@@ -165,6 +208,7 @@ func main() {
 		Metrics:                 metricsServerOptions,
 		WebhookServer:           webhookServer,
 		HealthProbeBindAddress:  probeAddr,
+		GracefulShutdownTimeout: &gracefulShutdownTimeout,
 		LeaderElection:          enableLeaderElection,
 		LeaderElectionID:        "f61bfab8.ironcore.dev",
 		LeaderElectionNamespace: leaderElectionNamespace,
@@ -185,26 +229,58 @@ func main() {
 		os.Exit(1)
 	}
 
+	for _, peer := range peers {
+		if err := mgr.Add(&metalbondspeaker.Connector{
+			Peer:    peer,
+			VNI:     vni,
+			Backoff: metalbondspeaker.DefaultConnectBackoff,
+		}); err != nil {
+			setupLog.Error(err, "unable to add metalbond connector", "Server", peer.Server)
+			os.Exit(1)
+		}
+	}
+
 	if err = (&metalbondspeaker.ServiceReconciler{
 		Client:      mgr.GetClient(),
 		Scheme:      mgr.GetScheme(),
+		Recorder:    mgr.GetEventRecorder("metalbond-speaker"),
 		VNI:         vni,
-		MetalBond:   mb,
+		Peers:       peers,
+		NodeName:    nodeName,
 		NodeAddress: nodeAddress,
+		Routes:      metalbondspeaker.NewAnnouncedRoutes(),
+
+		NodeAddressSelector: nodeAddressSelector,
+
+		RouteGCInterval: routeGCInterval,
+
+		LoadBalancerClass:           loadBalancerClass,
+		IncludeServicesWithoutClass: includeServicesWithoutClass,
+
+		NodeSelector: parsedNodeSelector,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Service")
 		os.Exit(1)
 	}
 	// +kubebuilder:scaffold:builder
 
+	sessionChecker := metalbondspeaker.NewSessionChecker(peers, vni, metalbondLivenessGracePeriod)
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
 	}
+	if err := mgr.AddHealthzCheck("metalbond", sessionChecker.Livez); err != nil {
+		setupLog.Error(err, "unable to set up metalbond health check")
+		os.Exit(1)
+	}
 	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddReadyzCheck("metalbond", sessionChecker.Readyz); err != nil {
+		setupLog.Error(err, "unable to set up metalbond ready check")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -212,3 +288,12 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// defaultNodeAddressTypes returns the default of --node-address-types.
+func defaultNodeAddressTypes() string {
+	types := make([]string, 0, len(metalbondspeaker.DefaultNodeAddressTypes))
+	for _, addressType := range metalbondspeaker.DefaultNodeAddressTypes {
+		types = append(types, string(addressType))
+	}
+	return strings.Join(types, ",")
+}
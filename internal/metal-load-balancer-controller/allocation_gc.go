@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metal_load_balancer_controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultAllocationGCInterval is the interval in which orphaned allocations are released if the
+// ServiceReconciler does not configure one.
+const DefaultAllocationGCInterval = 5 * time.Minute
+
+// allocationGarbageCollector periodically releases allocations of Services that no longer exist, e.g. because
+// the finalizer of a Service was removed by hand before its addresses were released.
+type allocationGarbageCollector struct {
+	reconciler *ServiceReconciler
+	interval   time.Duration
+}
+
+func (c *allocationGarbageCollector) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("allocation-gc")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.collect(ctx); err != nil {
+			log.Error(err, "Failed to collect orphaned allocations")
+		}
+	}, c.interval)
+	return nil
+}
+
+func (c *allocationGarbageCollector) collect(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("allocation-gc")
+
+	// Pools are listed before Services: every allocation is recorded for a Service that is already known,
+	// so an allocation listed here cannot belong to a Service missing from the later Service list.
+	pools, err := c.reconciler.listLoadBalancerIPPools(ctx)
+	if err != nil {
+		return err
+	}
+	serviceList := &corev1.ServiceList{}
+	if err := c.reconciler.List(ctx, serviceList); err != nil {
+		return fmt.Errorf("failed to list Services: %w", err)
+	}
+	uids := sets.New[types.UID]()
+	for _, service := range serviceList.Items {
+		uids.Insert(service.UID)
+	}
+
+	for i := range pools {
+		pool := &pools[i]
+		poolBase := pool.DeepCopy()
+		pool.Status.Allocations = slices.DeleteFunc(pool.Status.Allocations, func(allocation metalloadbalancerv1alpha1.IPAllocation) bool {
+			return !uids.Has(allocation.ServiceRef.UID)
+		})
+		if len(pool.Status.Allocations) == len(poolBase.Status.Allocations) {
+			continue
+		}
+
+		if err := c.reconciler.Status().Patch(ctx, pool, client.MergeFromWithOptions(poolBase, client.MergeFromWithOptimisticLock{})); err != nil {
+			return fmt.Errorf("failed to release orphaned allocations in LoadBalancerIPPool %s: %w", pool.Name, err)
+		}
+		log.Info("Released orphaned allocations", "LoadBalancerIPPool", pool.Name,
+			"Count", len(poolBase.Status.Allocations)-len(pool.Status.Allocations))
+	}
+	return nil
+}
@@ -0,0 +1,440 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metal_load_balancer_controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	"github.com/ironcore-dev/metal-load-balancer-controller/internal/prefixutils"
+	"github.com/ironcore-dev/metal-load-balancer-controller/internal/serviceutils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// errAllocationFailed is returned if no address can be allocated until the LoadBalancerIPPools or the Service
+// change, e.g. because all pools are exhausted. Such failures are retried after allocationRequeueInterval
+// instead of with the backoff of the workqueue.
+var errAllocationFailed = errors.New("failed to allocate IP")
+
+// allocationRequeueInterval is the interval in which Services are requeued while no address can be allocated.
+const allocationRequeueInterval = time.Minute
+
+// allocateServiceIP returns the address of the given IP family allocated to the service. If the service does
+// not hold an address of that family yet, the first free address of the first matching LoadBalancerIPPool is
+// allocated and recorded in the status of the pool.
+func (r *ServiceReconciler) allocateServiceIP(ctx context.Context, log logr.Logger, service *corev1.Service, family corev1.IPFamily) (netip.Addr, error) {
+	pools, err := r.listLoadBalancerIPPools(ctx)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	// inUse reports whether another Service uses the address, e.g. as ClusterIP.
+	inUse := func(addr netip.Addr) (bool, error) {
+		conflicting, err := r.findConflictingService(ctx, service, addr)
+		return conflicting != nil, err
+	}
+
+	poolName, err := r.servicePoolName(ctx, service)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	var (
+		replaced netip.Addr
+		// misplaced is an address held from another pool than the one referenced by the VNIMapping of the Service.
+		misplaced     netip.Addr
+		misplacedPool *metalloadbalancerv1alpha1.LoadBalancerIPPool
+	)
+allocations:
+	for i := range pools {
+		pool := &pools[i]
+		for _, allocation := range pool.Status.Allocations {
+			if allocation.ServiceRef.UID != service.UID {
+				continue
+			}
+			addr, err := netip.ParseAddr(allocation.IP)
+			if err != nil {
+				return netip.Addr{}, fmt.Errorf("invalid allocation %q in LoadBalancerIPPool %s: %w", allocation.IP, pool.Name, err)
+			}
+			if !isIPFamily(addr, family) {
+				continue
+			}
+
+			// Addresses another Service started to use after they were allocated are replaced.
+			conflicting, err := r.findConflictingService(ctx, service, addr)
+			if err != nil {
+				return netip.Addr{}, err
+			}
+			if conflicting != nil {
+				r.Recorder.Eventf(service, nil, corev1.EventTypeWarning, "IPConflict", "AllocateIP",
+					"Replacing IP %s, which is in use by Service %s/%s", addr, conflicting.Namespace, conflicting.Name)
+				if err := r.releaseAllocation(ctx, pool, service, addr); err != nil {
+					return netip.Addr{}, err
+				}
+				log.V(1).Info("Released conflicting IP", "IP", addr, "LoadBalancerIPPool", pool.Name)
+				replaced = addr
+				break allocations
+			}
+
+			// Addresses of another pool than the one of the VNIMapping, e.g. because the mapping was created or
+			// changed after the allocation, are replaced once an address of the mapped pool is allocated.
+			if poolName != "" && pool.Name != poolName {
+				misplaced, misplacedPool = addr, pool
+				replaced = addr
+				break allocations
+			}
+			return addr, nil
+		}
+	}
+
+	// The Service lost an address it published, e.g. because its LoadBalancerIPPool was deleted.
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if addr, err := netip.ParseAddr(ingress.IP); err == nil && isIPFamily(addr, family) && addr != replaced {
+			r.Recorder.Eventf(service, nil, corev1.EventTypeWarning, "AllocationLost", "AllocateIP",
+				"IP %s is no longer allocated from any LoadBalancerIPPool, allocating a new %s address", addr, family)
+		}
+	}
+
+	for i := range pools {
+		pool := &pools[i]
+		if poolName != "" && pool.Name != poolName {
+			continue
+		}
+		addr, ok, err := nextFreeAddr(pool, family, inUse)
+		if errors.Is(err, errInvalidPool) {
+			log.Error(err, "Skipping invalid LoadBalancerIPPool", "LoadBalancerIPPool", pool.Name)
+			continue
+		}
+		if err != nil {
+			return netip.Addr{}, err
+		}
+		if !ok {
+			continue
+		}
+
+		if err := r.recordAllocation(ctx, pool, service, addr); err != nil {
+			return netip.Addr{}, err
+		}
+		log.V(1).Info("Allocated IP", "IP", addr, "LoadBalancerIPPool", pool.Name)
+
+		if misplacedPool != nil {
+			r.Recorder.Eventf(service, nil, corev1.EventTypeNormal, "PoolMismatch", "AllocateIP",
+				"Replacing IP %s of LoadBalancerIPPool %s with %s of LoadBalancerIPPool %s referenced by the VNIMapping",
+				misplaced, misplacedPool.Name, addr, pool.Name)
+			if err := r.releaseAllocation(ctx, misplacedPool, service, misplaced); err != nil {
+				return netip.Addr{}, err
+			}
+			log.V(1).Info("Released IP of another LoadBalancerIPPool", "IP", misplaced, "LoadBalancerIPPool", misplacedPool.Name)
+		}
+		return addr, nil
+	}
+
+	if misplacedPool != nil {
+		// Keep the address until the mapped pool has a free one, rather than leaving the Service without one.
+		r.Recorder.Eventf(service, nil, corev1.EventTypeWarning, "PoolMismatch", "AllocateIP",
+			"IP %s is not allocated from LoadBalancerIPPool %s referenced by the VNIMapping, which has no free %s address",
+			misplaced, poolName, family)
+		return misplaced, nil
+	}
+	if poolName != "" {
+		r.Recorder.Eventf(service, nil, corev1.EventTypeWarning, "PoolExhausted", "AllocateIP",
+			"LoadBalancerIPPool %s has no free %s address", poolName, family)
+		return netip.Addr{}, fmt.Errorf("%w: LoadBalancerIPPool %s has no free %s address", errAllocationFailed, poolName, family)
+	}
+	r.Recorder.Eventf(service, nil, corev1.EventTypeWarning, "PoolExhausted", "AllocateIP",
+		"No LoadBalancerIPPool has a free %s address", family)
+	return netip.Addr{}, fmt.Errorf("%w: no LoadBalancerIPPool has a free %s address", errAllocationFailed, family)
+}
+
+// allocateRequestedServiceIP allocates the address requested by the service. The address has to be within
+// a LoadBalancerIPPool the service may use and must not be allocated to another service.
+func (r *ServiceReconciler) allocateRequestedServiceIP(ctx context.Context, log logr.Logger, service *corev1.Service, addr netip.Addr) error {
+	pools, err := r.listLoadBalancerIPPools(ctx)
+	if err != nil {
+		return err
+	}
+	poolName, err := r.servicePoolName(ctx, service)
+	if err != nil {
+		return err
+	}
+
+	var pool *metalloadbalancerv1alpha1.LoadBalancerIPPool
+	for i := range pools {
+		for _, allocation := range pools[i].Status.Allocations {
+			if allocation.IP != addr.String() {
+				continue
+			}
+			if allocation.ServiceRef.UID == service.UID {
+				return nil
+			}
+			r.Recorder.Eventf(service, nil, corev1.EventTypeWarning, "RequestedIPInUse", "AllocateIP",
+				"Requested IP %s is already in use by Service %s/%s", addr, allocation.ServiceRef.Namespace, allocation.ServiceRef.Name)
+			return fmt.Errorf("%w: requested IP %s is already in use by Service %s/%s", errAllocationFailed, addr, allocation.ServiceRef.Namespace, allocation.ServiceRef.Name)
+		}
+		if pool == nil && (poolName == "" || pools[i].Name == poolName) && poolContains(&pools[i], addr) {
+			pool = &pools[i]
+		}
+	}
+	if pool == nil && poolName != "" {
+		r.Recorder.Eventf(service, nil, corev1.EventTypeWarning, "RequestedIPNotAllowed", "AllocateIP",
+			"Requested IP %s is not within LoadBalancerIPPool %s of the VNIMapping of the namespace", addr, poolName)
+		return fmt.Errorf("%w: requested IP %s is not within LoadBalancerIPPool %s", errAllocationFailed, addr, poolName)
+	}
+	if pool == nil {
+		r.Recorder.Eventf(service, nil, corev1.EventTypeWarning, "RequestedIPNotAllowed", "AllocateIP",
+			"Requested IP %s is not within any LoadBalancerIPPool", addr)
+		return fmt.Errorf("%w: requested IP %s is not within any LoadBalancerIPPool", errAllocationFailed, addr)
+	}
+
+	if err := r.recordAllocation(ctx, pool, service, addr); err != nil {
+		return err
+	}
+	log.V(1).Info("Allocated requested IP", "IP", addr, "LoadBalancerIPPool", pool.Name)
+	return nil
+}
+
+func (r *ServiceReconciler) recordAllocation(ctx context.Context, pool *metalloadbalancerv1alpha1.LoadBalancerIPPool, service *corev1.Service, addr netip.Addr) error {
+	poolBase := pool.DeepCopy()
+	pool.Status.Allocations = append(pool.Status.Allocations, metalloadbalancerv1alpha1.IPAllocation{
+		IP: addr.String(),
+		ServiceRef: metalloadbalancerv1alpha1.ServiceReference{
+			Namespace: service.Namespace,
+			Name:      service.Name,
+			UID:       service.UID,
+		},
+	})
+	if err := r.Status().Patch(ctx, pool, client.MergeFromWithOptions(poolBase, client.MergeFromWithOptimisticLock{})); err != nil {
+		return fmt.Errorf("failed to record allocation in LoadBalancerIPPool %s: %w", pool.Name, err)
+	}
+	return nil
+}
+
+// releaseAllocation removes the allocation of the given address to the service from the pool.
+func (r *ServiceReconciler) releaseAllocation(ctx context.Context, pool *metalloadbalancerv1alpha1.LoadBalancerIPPool, service *corev1.Service, addr netip.Addr) error {
+	poolBase := pool.DeepCopy()
+	pool.Status.Allocations = slices.DeleteFunc(pool.Status.Allocations, func(allocation metalloadbalancerv1alpha1.IPAllocation) bool {
+		return allocation.ServiceRef.UID == service.UID && allocation.IP == addr.String()
+	})
+	if err := r.Status().Patch(ctx, pool, client.MergeFromWithOptions(poolBase, client.MergeFromWithOptimisticLock{})); err != nil {
+		return fmt.Errorf("failed to release IP %s in LoadBalancerIPPool %s: %w", addr, pool.Name, err)
+	}
+	return nil
+}
+
+// releaseServiceIPs removes the allocations of the given service from the LoadBalancerIPPools, except for
+// the retained addresses.
+func (r *ServiceReconciler) releaseServiceIPs(ctx context.Context, log logr.Logger, service *corev1.Service, retain ...netip.Addr) error {
+	pools, err := r.listLoadBalancerIPPools(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range pools {
+		pool := &pools[i]
+		poolBase := pool.DeepCopy()
+		pool.Status.Allocations = slices.DeleteFunc(pool.Status.Allocations, func(allocation metalloadbalancerv1alpha1.IPAllocation) bool {
+			if allocation.ServiceRef.UID != service.UID {
+				return false
+			}
+			addr, err := netip.ParseAddr(allocation.IP)
+			return err != nil || !slices.Contains(retain, addr)
+		})
+		if len(pool.Status.Allocations) == len(poolBase.Status.Allocations) {
+			continue
+		}
+
+		if err := r.Status().Patch(ctx, pool, client.MergeFromWithOptions(poolBase, client.MergeFromWithOptimisticLock{})); err != nil {
+			return fmt.Errorf("failed to release allocations in LoadBalancerIPPool %s: %w", pool.Name, err)
+		}
+		log.V(1).Info("Released IPs", "LoadBalancerIPPool", pool.Name)
+	}
+	return nil
+}
+
+// servicePoolName returns the name of the LoadBalancerIPPool the VNIMapping of the namespace of the service
+// restricts new allocations to, or an empty string if any pool may be used.
+func (r *ServiceReconciler) servicePoolName(ctx context.Context, service *corev1.Service) (string, error) {
+	mapping, err := serviceutils.GetVNIMapping(ctx, r.Client, service)
+	if err != nil {
+		return "", err
+	}
+	if mapping == nil || mapping.Spec.IPPoolRef == nil {
+		return "", nil
+	}
+	return mapping.Spec.IPPoolRef.Name, nil
+}
+
+func (r *ServiceReconciler) listLoadBalancerIPPools(ctx context.Context) ([]metalloadbalancerv1alpha1.LoadBalancerIPPool, error) {
+	poolList := &metalloadbalancerv1alpha1.LoadBalancerIPPoolList{}
+	if err := r.List(ctx, poolList); err != nil {
+		return nil, fmt.Errorf("failed to list LoadBalancerIPPools: %w", err)
+	}
+
+	pools := poolList.Items
+	slices.SortFunc(pools, func(a, b metalloadbalancerv1alpha1.LoadBalancerIPPool) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return pools, nil
+}
+
+// errInvalidPool is returned for LoadBalancerIPPools with invalid CIDRs, exclusions or allocations.
+var errInvalidPool = errors.New("invalid LoadBalancerIPPool")
+
+// nextFreeAddr returns the next address of the given IP family that is neither excluded nor allocated
+// in the pool nor in use according to inUse, honoring the allocation order of the pool.
+func nextFreeAddr(pool *metalloadbalancerv1alpha1.LoadBalancerIPPool, family corev1.IPFamily, inUse func(netip.Addr) (bool, error)) (netip.Addr, bool, error) {
+	cidrs, err := prefixutils.Parse(pool.Spec.CIDRs)
+	if err != nil {
+		return netip.Addr{}, false, fmt.Errorf("%w: invalid cidrs: %w", errInvalidPool, err)
+	}
+	exclusions, err := prefixutils.Parse(pool.Spec.Exclusions)
+	if err != nil {
+		return netip.Addr{}, false, fmt.Errorf("%w: invalid exclusions: %w", errInvalidPool, err)
+	}
+
+	allocated := sets.New[netip.Addr]()
+	for _, allocation := range pool.Status.Allocations {
+		addr, err := netip.ParseAddr(allocation.IP)
+		if err != nil {
+			return netip.Addr{}, false, fmt.Errorf("%w: invalid allocation %q: %w", errInvalidPool, allocation.IP, err)
+		}
+		allocated.Insert(addr)
+	}
+	isFree := func(addr netip.Addr) (bool, error) {
+		if allocated.Has(addr) {
+			return false, nil
+		}
+		if inUse == nil {
+			return true, nil
+		}
+		used, err := inUse(addr)
+		return !used, err
+	}
+
+	descending := pool.Spec.AllocationOrder == metalloadbalancerv1alpha1.AllocationOrderDescending
+	if descending {
+		slices.Reverse(cidrs)
+	}
+
+	for _, cidr := range cidrs {
+		if !isIPFamily(cidr.Addr(), family) {
+			continue
+		}
+
+		var (
+			addr netip.Addr
+			ok   bool
+		)
+		if descending {
+			addr, ok, err = lastFreeAddr(cidr, exclusions, isFree)
+		} else {
+			addr, ok, err = firstFreeAddr(cidr, exclusions, isFree)
+		}
+		if err != nil || ok {
+			return addr, ok, err
+		}
+	}
+	return netip.Addr{}, false, nil
+}
+
+func firstFreeAddr(cidr netip.Prefix, exclusions []netip.Prefix, isFree func(netip.Addr) (bool, error)) (netip.Addr, bool, error) {
+	first, last := usableRange(cidr)
+	for addr := first; addr.IsValid() && addr.Compare(last) <= 0; addr = addr.Next() {
+		if exclusion, ok := containingPrefix(exclusions, addr); ok {
+			// Skip the whole excluded range at once.
+			addr = lastAddr(exclusion)
+			continue
+		}
+		if free, err := isFree(addr); err != nil || free {
+			return addr, free, err
+		}
+	}
+	return netip.Addr{}, false, nil
+}
+
+func lastFreeAddr(cidr netip.Prefix, exclusions []netip.Prefix, isFree func(netip.Addr) (bool, error)) (netip.Addr, bool, error) {
+	first, last := usableRange(cidr)
+	for addr := last; addr.IsValid() && addr.Compare(first) >= 0; addr = addr.Prev() {
+		if exclusion, ok := containingPrefix(exclusions, addr); ok {
+			// Skip the whole excluded range at once.
+			addr = exclusion.Addr()
+			continue
+		}
+		if free, err := isFree(addr); err != nil || free {
+			return addr, free, err
+		}
+	}
+	return netip.Addr{}, false, nil
+}
+
+// usableRange returns the first and last address of the cidr that may be allocated. The network and broadcast
+// addresses of IPv4 CIDRs are skipped, except for /31 and /32 CIDRs, which have none.
+func usableRange(cidr netip.Prefix) (first, last netip.Addr) {
+	first, last = cidr.Addr(), lastAddr(cidr)
+	if cidr.Addr().Is4() && cidr.Bits() < 31 {
+		first, last = first.Next(), last.Prev()
+	}
+	return first, last
+}
+
+// poolContains reports whether the given address is a usable address of the CIDRs of the pool and not excluded.
+func poolContains(pool *metalloadbalancerv1alpha1.LoadBalancerIPPool, addr netip.Addr) bool {
+	cidrs, err := prefixutils.Parse(pool.Spec.CIDRs)
+	if err != nil {
+		return false
+	}
+	exclusions, err := prefixutils.Parse(pool.Spec.Exclusions)
+	if err != nil {
+		return false
+	}
+
+	cidr, ok := containingPrefix(cidrs, addr)
+	if !ok {
+		return false
+	}
+	if first, last := usableRange(cidr); addr.Less(first) || last.Less(addr) {
+		return false
+	}
+	_, excluded := containingPrefix(exclusions, addr)
+	return !excluded
+}
+
+func containingPrefix(prefixes []netip.Prefix, addr netip.Addr) (netip.Prefix, bool) {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return prefix, true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+// lastAddr returns the highest address contained in the given prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Masked().Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+func isIPFamily(addr netip.Addr, family corev1.IPFamily) bool {
+	switch family {
+	case corev1.IPv4Protocol:
+		return addr.Is4()
+	case corev1.IPv6Protocol:
+		return addr.Is6()
+	default:
+		return false
+	}
+}
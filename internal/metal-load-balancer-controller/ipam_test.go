@@ -0,0 +1,200 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metal_load_balancer_controller
+
+import (
+	"errors"
+	"net/netip"
+
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("IPAM", func() {
+	DescribeTable("nextFreeAddr",
+		func(spec metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec, allocated []string, family corev1.IPFamily, inUse []string, want string) {
+			pool := &metalloadbalancerv1alpha1.LoadBalancerIPPool{Spec: spec}
+			for _, ip := range allocated {
+				pool.Status.Allocations = append(pool.Status.Allocations, metalloadbalancerv1alpha1.IPAllocation{IP: ip})
+			}
+			used := sets.New[netip.Addr]()
+			for _, ip := range inUse {
+				used.Insert(netip.MustParseAddr(ip))
+			}
+
+			addr, ok, err := nextFreeAddr(pool, family, func(addr netip.Addr) (bool, error) {
+				return used.Has(addr), nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			if want == "" {
+				Expect(ok).To(BeFalse())
+				return
+			}
+			Expect(ok).To(BeTrue())
+			Expect(addr).To(Equal(netip.MustParseAddr(want)))
+		},
+		Entry("first address of the first cidr",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"2001:db8::/126", "2001:db8:1::/126"}},
+			nil, corev1.IPv6Protocol, nil, "2001:db8::"),
+		Entry("skips allocated addresses",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"2001:db8::/126"}},
+			[]string{"2001:db8::", "2001:db8::1"}, corev1.IPv6Protocol, nil, "2001:db8::2"),
+		Entry("skips excluded ranges",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{
+				CIDRs:      []string{"2001:db8::/120"},
+				Exclusions: []string{"2001:db8::/125", "2001:db8::8"},
+			},
+			nil, corev1.IPv6Protocol, nil, "2001:db8::9"),
+		Entry("continues with the next cidr",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"2001:db8::/127", "2001:db8:1::/127"}},
+			[]string{"2001:db8::", "2001:db8::1"}, corev1.IPv6Protocol, nil, "2001:db8:1::"),
+		Entry("descending starts at the last address of the last cidr",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{
+				CIDRs:           []string{"2001:db8::/126", "2001:db8:1::/126"},
+				AllocationOrder: metalloadbalancerv1alpha1.AllocationOrderDescending,
+			},
+			nil, corev1.IPv6Protocol, nil, "2001:db8:1::3"),
+		Entry("descending skips excluded and allocated addresses",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{
+				CIDRs:           []string{"2001:db8::/120"},
+				Exclusions:      []string{"2001:db8::f8/125"},
+				AllocationOrder: metalloadbalancerv1alpha1.AllocationOrderDescending,
+			},
+			[]string{"2001:db8::f7"}, corev1.IPv6Protocol, nil, "2001:db8::f6"),
+		Entry("only uses cidrs of the family",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"2001:db8::/126", "192.0.2.0/31"}},
+			nil, corev1.IPv4Protocol, nil, "192.0.2.0"),
+		Entry("skips the network address of ipv4 cidrs",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"192.0.2.0/24"}},
+			nil, corev1.IPv4Protocol, nil, "192.0.2.1"),
+		Entry("descending skips the broadcast address of ipv4 cidrs",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{
+				CIDRs:           []string{"192.0.2.0/24"},
+				AllocationOrder: metalloadbalancerv1alpha1.AllocationOrderDescending,
+			},
+			nil, corev1.IPv4Protocol, nil, "192.0.2.254"),
+		Entry("uses both addresses of ipv4 /31 cidrs",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{
+				CIDRs:           []string{"192.0.2.0/31"},
+				AllocationOrder: metalloadbalancerv1alpha1.AllocationOrderDescending,
+			},
+			nil, corev1.IPv4Protocol, nil, "192.0.2.1"),
+		Entry("uses ipv4 /32 cidrs",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"192.0.2.7/32"}},
+			nil, corev1.IPv4Protocol, nil, "192.0.2.7"),
+		Entry("exhausted ipv4 /30 cidr",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"192.0.2.0/30"}},
+			[]string{"192.0.2.1", "192.0.2.2"}, corev1.IPv4Protocol, nil, ""),
+		Entry("skips addresses in use by other Services",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"2001:db8::/126"}},
+			[]string{"2001:db8::"}, corev1.IPv6Protocol, []string{"2001:db8::1", "2001:db8::2"}, "2001:db8::3"),
+		Entry("descending skips addresses in use by other Services",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{
+				CIDRs:           []string{"192.0.2.0/24"},
+				AllocationOrder: metalloadbalancerv1alpha1.AllocationOrderDescending,
+			},
+			nil, corev1.IPv4Protocol, []string{"192.0.2.254"}, "192.0.2.253"),
+		Entry("exhausted by addresses in use",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"2001:db8::/127"}},
+			[]string{"2001:db8::"}, corev1.IPv6Protocol, []string{"2001:db8::1"}, ""),
+		Entry("exhausted pool",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"2001:db8::/127"}, Exclusions: []string{"2001:db8::"}},
+			[]string{"2001:db8::1"}, corev1.IPv6Protocol, nil, ""),
+		Entry("no cidr of the family",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"2001:db8::/126"}},
+			nil, corev1.IPv4Protocol, nil, ""),
+	)
+
+	It("should reject invalid pools and pass on lookup errors", func() {
+		pool := &metalloadbalancerv1alpha1.LoadBalancerIPPool{Spec: metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{
+			CIDRs: []string{"invalid"},
+		}}
+		_, _, err := nextFreeAddr(pool, corev1.IPv4Protocol, nil)
+		Expect(err).To(MatchError(errInvalidPool))
+
+		pool.Spec = metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"192.0.2.0/24"}, Exclusions: []string{"invalid"}}
+		_, _, err = nextFreeAddr(pool, corev1.IPv4Protocol, nil)
+		Expect(err).To(MatchError(errInvalidPool))
+
+		pool.Spec = metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"192.0.2.0/24"}}
+		pool.Status.Allocations = []metalloadbalancerv1alpha1.IPAllocation{{IP: "invalid"}}
+		_, _, err = nextFreeAddr(pool, corev1.IPv4Protocol, nil)
+		Expect(err).To(MatchError(errInvalidPool))
+
+		pool.Status.Allocations = nil
+		lookupErr := errors.New("lookup failed")
+		_, _, err = nextFreeAddr(pool, corev1.IPv4Protocol, func(netip.Addr) (bool, error) {
+			return false, lookupErr
+		})
+		Expect(err).To(MatchError(lookupErr))
+		Expect(err).NotTo(MatchError(errInvalidPool))
+	})
+
+	DescribeTable("lastAddr",
+		func(prefix, want string) {
+			Expect(lastAddr(netip.MustParsePrefix(prefix))).To(Equal(netip.MustParseAddr(want)))
+		},
+		Entry("ipv4", "192.0.2.0/24", "192.0.2.255"),
+		Entry("ipv4 /32", "192.0.2.7/32", "192.0.2.7"),
+		Entry("ipv4 /8", "10.0.0.0/8", "10.255.255.255"),
+		Entry("ipv6", "2001:db8::/64", "2001:db8::ffff:ffff:ffff:ffff"),
+		Entry("ipv6 /127", "2001:db8::/127", "2001:db8::1"),
+	)
+
+	DescribeTable("poolContains",
+		func(addr string, want bool) {
+			pool := &metalloadbalancerv1alpha1.LoadBalancerIPPool{Spec: metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{
+				CIDRs:      []string{"192.0.2.0/24", "2001:db8::/64"},
+				Exclusions: []string{"192.0.2.0/28", "2001:db8::1"},
+			}}
+			Expect(poolContains(pool, netip.MustParseAddr(addr))).To(Equal(want))
+		},
+		Entry("usable ipv4 address", "192.0.2.16", true),
+		Entry("ipv4 broadcast address", "192.0.2.255", false),
+		Entry("excluded ipv4 address", "192.0.2.15", false),
+		Entry("address outside of the cidrs", "198.51.100.1", false),
+		Entry("usable ipv6 address", "2001:db8::2", true),
+		Entry("excluded ipv6 address", "2001:db8::1", false),
+	)
+
+	dualStack := []corev1.IPFamily{corev1.IPv6Protocol, corev1.IPv4Protocol}
+	DescribeTable("serviceRequestedIPs",
+		func(annotation *string, loadBalancerIP string, families []corev1.IPFamily, want map[corev1.IPFamily]netip.Addr, wantErr bool) {
+			service := &corev1.Service{Spec: corev1.ServiceSpec{LoadBalancerIP: loadBalancerIP}}
+			if annotation != nil {
+				service.ObjectMeta = metav1.ObjectMeta{
+					Annotations: map[string]string{metalloadbalancerv1alpha1.ServiceIPAnnotation: *annotation},
+				}
+			}
+			requested, err := serviceRequestedIPs(service, families)
+			if wantErr {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			if want == nil {
+				Expect(requested).To(BeEmpty())
+				return
+			}
+			Expect(requested).To(Equal(want))
+		},
+		Entry("nothing requested", nil, "", dualStack, nil, false),
+		Entry("spec.loadBalancerIP", nil, "192.0.2.1", dualStack,
+			map[corev1.IPFamily]netip.Addr{corev1.IPv4Protocol: netip.MustParseAddr("192.0.2.1")}, false),
+		Entry("annotation takes precedence", ptr.To("2001:db8::1, 192.0.2.2"), "192.0.2.1", dualStack,
+			map[corev1.IPFamily]netip.Addr{
+				corev1.IPv6Protocol: netip.MustParseAddr("2001:db8::1"),
+				corev1.IPv4Protocol: netip.MustParseAddr("192.0.2.2"),
+			}, false),
+		Entry("empty annotation overrides spec.loadBalancerIP", ptr.To(""), "192.0.2.1", dualStack, nil, false),
+		Entry("invalid address", ptr.To("192.0.2.256"), "", dualStack, nil, true),
+		Entry("family of the Service", ptr.To("2001:db8::1"), "", []corev1.IPFamily{corev1.IPv4Protocol}, nil, true),
+		Entry("multiple addresses of a family", ptr.To("192.0.2.1,192.0.2.2"), "", dualStack, nil, true),
+	)
+})
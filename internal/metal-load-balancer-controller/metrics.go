@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metal_load_balancer_controller
+
+import (
+	"context"
+	"math"
+	"net/netip"
+	"slices"
+	"time"
+
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	"github.com/ironcore-dev/metal-load-balancer-controller/internal/prefixutils"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	poolSizeDesc = prometheus.NewDesc(
+		"metal_loadbalancer_ippool_addresses",
+		"Number of allocatable addresses of a LoadBalancerIPPool.",
+		[]string{"pool", "family"}, nil,
+	)
+	poolUsedDesc = prometheus.NewDesc(
+		"metal_loadbalancer_ippool_addresses_used",
+		"Number of addresses of a LoadBalancerIPPool allocated to Services.",
+		[]string{"pool", "family"}, nil,
+	)
+	poolFreeDesc = prometheus.NewDesc(
+		"metal_loadbalancer_ippool_addresses_free",
+		"Number of allocatable addresses of a LoadBalancerIPPool not allocated to Services.",
+		[]string{"pool", "family"}, nil,
+	)
+)
+
+// poolCollector reports the size and usage of all LoadBalancerIPPools on every scrape.
+type poolCollector struct {
+	client client.Reader
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolSizeDesc
+	ch <- poolUsedDesc
+	ch <- poolFreeDesc
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	poolList := &metalloadbalancerv1alpha1.LoadBalancerIPPoolList{}
+	if err := c.client.List(ctx, poolList); err != nil {
+		ctrl.Log.WithName("metrics").Error(err, "Failed to list LoadBalancerIPPools")
+		return
+	}
+
+	for i := range poolList.Items {
+		pool := &poolList.Items[i]
+		size, used, free, err := poolUsage(pool)
+		if err != nil {
+			ctrl.Log.WithName("metrics").Error(err, "Skipping invalid LoadBalancerIPPool", "LoadBalancerIPPool", pool.Name)
+			continue
+		}
+		for _, family := range []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol} {
+			if size[family] == 0 {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(poolSizeDesc, prometheus.GaugeValue, size[family], pool.Name, string(family))
+			ch <- prometheus.MustNewConstMetric(poolUsedDesc, prometheus.GaugeValue, used[family], pool.Name, string(family))
+			ch <- prometheus.MustNewConstMetric(poolFreeDesc, prometheus.GaugeValue, free[family], pool.Name, string(family))
+		}
+	}
+}
+
+// poolUsage returns the number of usable, allocated and free addresses of the pool per IP family. Usable
+// addresses are the addresses of its CIDRs without its exclusions and the network and broadcast addresses of
+// IPv4 CIDRs. Sizes are floats, as IPv6 CIDRs easily exceed 64 bits.
+func poolUsage(pool *metalloadbalancerv1alpha1.LoadBalancerIPPool) (size, used, free map[corev1.IPFamily]float64, err error) {
+	cidrs, err := prefixutils.Parse(pool.Spec.CIDRs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	exclusions, err := prefixutils.Parse(pool.Spec.Exclusions)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Overlapping CIDRs and exclusions are subtracted once, by excluding the CIDRs already counted as well.
+	var usable []netip.Prefix
+	for i, cidr := range cidrs {
+		excluded := slices.Concat(exclusions, cidrs[:i])
+		if first, last := usableRange(cidr); first != cidr.Addr() || last != lastAddr(cidr) {
+			// The network and broadcast addresses are never allocated.
+			excluded = append(excluded,
+				netip.PrefixFrom(cidr.Addr(), cidr.Addr().BitLen()),
+				netip.PrefixFrom(lastAddr(cidr), cidr.Addr().BitLen()),
+			)
+		}
+		usable = append(usable, prefixutils.Subtract(cidr, excluded)...)
+	}
+
+	size = make(map[corev1.IPFamily]float64)
+	used = make(map[corev1.IPFamily]float64)
+	free = make(map[corev1.IPFamily]float64)
+	for _, prefix := range usable {
+		size[addrFamily(prefix.Addr())] += prefixSize(prefix)
+		free[addrFamily(prefix.Addr())] += prefixSize(prefix)
+	}
+	for _, allocation := range pool.Status.Allocations {
+		addr, err := netip.ParseAddr(allocation.IP)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		used[addrFamily(addr)]++
+		// Allocations outside of the usable addresses, e.g. of an exclusion added later, take no free address.
+		if slices.ContainsFunc(usable, func(prefix netip.Prefix) bool { return prefix.Contains(addr) }) {
+			free[addrFamily(addr)]--
+		}
+	}
+	return size, used, free, nil
+}
+
+func prefixSize(prefix netip.Prefix) float64 {
+	return math.Exp2(float64(prefix.Addr().BitLen() - prefix.Bits()))
+}
+
+func addrFamily(addr netip.Addr) corev1.IPFamily {
+	if addr.Is4() {
+		return corev1.IPv4Protocol
+	}
+	return corev1.IPv6Protocol
+}
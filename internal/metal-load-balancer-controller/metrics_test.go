@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metal_load_balancer_controller
+
+import (
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
+)
+
+var _ = Describe("Metrics", func() {
+	DescribeTable("poolUsage",
+		func(spec metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec, allocated []string, size, used, free float64) {
+			pool := &metalloadbalancerv1alpha1.LoadBalancerIPPool{Spec: spec}
+			for _, ip := range allocated {
+				pool.Status.Allocations = append(pool.Status.Allocations, metalloadbalancerv1alpha1.IPAllocation{IP: ip})
+			}
+			gotSize, gotUsed, gotFree, err := poolUsage(pool)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gotSize[corev1.IPv4Protocol]).To(Equal(size))
+			Expect(gotUsed[corev1.IPv4Protocol]).To(Equal(used))
+			Expect(gotFree[corev1.IPv4Protocol]).To(Equal(free))
+		},
+		Entry("network and broadcast",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"192.0.2.0/24"}},
+			[]string{"192.0.2.1"}, 254.0, 1.0, 253.0),
+		Entry("/31",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"192.0.2.0/31"}},
+			nil, 2.0, 0.0, 2.0),
+		Entry("overlapping exclusions",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{
+				CIDRs:      []string{"192.0.2.0/24"},
+				Exclusions: []string{"192.0.2.0/28", "192.0.2.0/29", "192.0.2.5", "192.0.2.255"},
+			},
+			nil, 239.0, 0.0, 239.0),
+		Entry("exclusion covering the CIDR",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{
+				CIDRs:      []string{"192.0.2.0/28", "198.51.100.0/30"},
+				Exclusions: []string{"192.0.2.0/24"},
+			},
+			nil, 2.0, 0.0, 2.0),
+		Entry("overlapping CIDRs",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"192.0.2.0/24", "192.0.2.0/25"}},
+			nil, 254.0, 0.0, 254.0),
+		Entry("allocation of an exclusion",
+			metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: []string{"192.0.2.0/29"}, Exclusions: []string{"192.0.2.1"}},
+			[]string{"192.0.2.1", "192.0.2.2"}, 5.0, 2.0, 4.0),
+	)
+
+	It("should count IPv6 addresses beyond 64 bits", func() {
+		pool := &metalloadbalancerv1alpha1.LoadBalancerIPPool{
+			Spec: metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{
+				CIDRs:      []string{"2001:db8::/64"},
+				Exclusions: []string{"2001:db8::/65"},
+			},
+			Status: metalloadbalancerv1alpha1.LoadBalancerIPPoolStatus{
+				Allocations: []metalloadbalancerv1alpha1.IPAllocation{{IP: "2001:db8::8000:0:0:1"}},
+			},
+		}
+		size, used, _, err := poolUsage(pool)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(size[corev1.IPv6Protocol]).To(Equal(float64(1 << 63)))
+		Expect(used[corev1.IPv6Protocol]).To(Equal(1.0))
+	})
+
+	Context("poolCollector", func() {
+		ns := SetupTest()
+
+		It("should report the usage of the pools allocated by the reconciler", func(ctx SpecContext) {
+			By("creating a pool with a Service allocated from it")
+			pool := createPool(ctx, "192.0.2.0/29")
+			service := createLoadBalancerService(ctx, ns.Name)
+			Eventually(Object(service)).Should(HaveField("Status.LoadBalancer.Ingress", HaveLen(1)))
+
+			registry := prometheus.NewPedanticRegistry()
+			Expect(registry.Register(&poolCollector{client: k8sClient})).To(Succeed())
+			poolGauge := func(name string) float64 {
+				families, err := registry.Gather()
+				Expect(err).NotTo(HaveOccurred())
+				for _, family := range families {
+					if family.GetName() != name {
+						continue
+					}
+					for _, metric := range family.GetMetric() {
+						if hasLabel(metric, "pool", pool.Name) && hasLabel(metric, "family", string(corev1.IPv4Protocol)) {
+							return metric.GetGauge().GetValue()
+						}
+					}
+				}
+				return -1
+			}
+
+			Expect(poolGauge("metal_loadbalancer_ippool_addresses")).To(Equal(6.0))
+			Expect(poolGauge("metal_loadbalancer_ippool_addresses_used")).To(Equal(1.0))
+			Expect(poolGauge("metal_loadbalancer_ippool_addresses_free")).To(Equal(5.0))
+		})
+	})
+})
+
+func hasLabel(metric *dto.Metric, name, value string) bool {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == name && label.GetValue() == value {
+			return true
+		}
+	}
+	return false
+}
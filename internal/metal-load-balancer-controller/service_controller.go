@@ -5,25 +5,58 @@ package metal_load_balancer_controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/netip"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	"github.com/ironcore-dev/metal-load-balancer-controller/internal/serviceutils"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 // ServiceReconciler reconciles a Service object
 type ServiceReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder events.EventRecorder
+
+	LoadBalancerClass           string
+	IncludeServicesWithoutClass bool
+
+	// AllocationGCInterval is the interval in which allocations of deleted Services are released. Defaults
+	// to DefaultAllocationGCInterval.
+	AllocationGCInterval time.Duration
 }
 
+var (
+	AllocationFinalizer = "metal-loadbalancer.ironcore.dev/ip-allocation"
+)
+
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=services/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups="",resources=services/finalizers,verbs=update
+// +kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=metal-loadbalancer.ironcore.dev,resources=loadbalancerippools,verbs=get;list;watch
+// +kubebuilder:rbac:groups=metal-loadbalancer.ironcore.dev,resources=loadbalancerippools/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=metal-loadbalancer.ironcore.dev,resources=vnimappings,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -33,6 +66,9 @@ func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	if err := r.Get(ctx, req.NamespacedName, service); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	if serviceutils.HasOtherLoadBalancerClass(service, r.LoadBalancerClass) {
+		return ctrl.Result{}, nil
+	}
 
 	return r.reconcileExists(ctx, log, service)
 }
@@ -45,56 +81,354 @@ func (r *ServiceReconciler) reconcileExists(ctx context.Context, log logr.Logger
 }
 
 func (r *ServiceReconciler) delete(ctx context.Context, log logr.Logger, service *corev1.Service) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(service, AllocationFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
 	log.V(1).Info("Deleting Service")
 
+	if err := r.cleanup(ctx, log, service); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	log.V(1).Info("Deleted Service")
 	return ctrl.Result{}, nil
 }
 
-func (r *ServiceReconciler) reconcile(ctx context.Context, _ logr.Logger, service *corev1.Service) (ctrl.Result, error) {
-	if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+// cleanup releases all addresses of the Service and removes the finalizer. The addresses are kept until the
+// speakers of all nodes withdrew their routes, so they are not handed to another Service while still announced.
+// The Service is reconciled again once the speakers remove their finalizers.
+func (r *ServiceReconciler) cleanup(ctx context.Context, log logr.Logger, service *corev1.Service) error {
+	if serviceutils.HasNodeFinalizers(service) {
+		log.V(1).Info("Waiting for the speakers to withdraw the routes of the Service")
+		return nil
+	}
+
+	if err := r.releaseServiceIPs(ctx, log, service); err != nil {
+		return err
+	}
+
+	log.V(1).Info("Ensuring that the finalizer is removed")
+	if _, err := serviceutils.PatchEnsureNoFinalizers(ctx, r.Client, service, AllocationFinalizer); err != nil {
+		return err
+	}
+	return nil
+}
+
+// reconcileNonLoadBalancer clears the status of a Service that is no longer a managed LoadBalancer and
+// releases its addresses.
+func (r *ServiceReconciler) reconcileNonLoadBalancer(ctx context.Context, log logr.Logger, service *corev1.Service) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(service, AllocationFinalizer) {
 		return ctrl.Result{}, nil
 	}
+	log.V(1).Info("Service is no longer a managed LoadBalancer")
+
+	serviceBase := service.DeepCopy()
+	service.Status.LoadBalancer.Ingress = nil
+	for _, conditionType := range []string{
+		metalloadbalancerv1alpha1.ServiceIPConflictCondition,
+		metalloadbalancerv1alpha1.ServiceIPAllocatedCondition,
+		metalloadbalancerv1alpha1.ServiceAnnouncedCondition,
+		metalloadbalancerv1alpha1.ServiceAnnouncementFailedCondition,
+	} {
+		meta.RemoveStatusCondition(&service.Status.Conditions, conditionType)
+	}
+	if err := r.Status().Patch(ctx, service, client.MergeFromWithOptions(serviceBase, client.MergeFromWithOptimisticLock{})); err != nil {
+		return ctrl.Result{}, err
+	}
+	log.V(1).Info("Cleared LoadBalancer status")
 
-	newServiceIP, err := generateServiceIP(service)
+	if err := r.cleanup(ctx, log, service); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *ServiceReconciler) reconcile(ctx context.Context, log logr.Logger, service *corev1.Service) (ctrl.Result, error) {
+	if !r.isManagedLoadBalancer(service) {
+		return r.reconcileNonLoadBalancer(ctx, log, service)
+	}
+
+	if modified, err := serviceutils.PatchEnsureFinalizer(ctx, r.Client, service, AllocationFinalizer); err != nil || modified {
+		return ctrl.Result{}, err
+	}
+	log.V(1).Info("Ensured finalizer has been added")
+
+	families, err := serviceIPFamilies(service)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	serviceBase := service.DeepCopy()
-	service.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{
-		{
-			IP: newServiceIP,
-		},
+	requestedIPs, err := serviceRequestedIPs(service, families)
+	if err != nil {
+		r.Recorder.Eventf(service, nil, corev1.EventTypeWarning, "InvalidRequestedIP", "AllocateIP", "Unable to honor requested IP: %v", err)
+		// Retrying does not help until the Service is changed.
+		return ctrl.Result{}, r.patchCondition(ctx, service, metalloadbalancerv1alpha1.ServiceIPAllocatedCondition, metav1.ConditionFalse, "InvalidRequestedIP", err.Error())
 	}
+
+	var (
+		serviceIPs []netip.Addr
+		ingress    []corev1.LoadBalancerIngress
+	)
+	for i, family := range families {
+		serviceIP, requested := requestedIPs[family]
+		if requested {
+			err = r.allocateRequestedServiceIP(ctx, log, service, serviceIP)
+		} else {
+			serviceIP, err = r.allocateServiceIP(ctx, log, service, family)
+		}
+		if err != nil {
+			if !errors.Is(err, errAllocationFailed) {
+				return ctrl.Result{}, err
+			}
+			// A PreferDualStack Service can still be served by its primary IP family. Other errors are retried
+			// instead, as the address of the secondary family would be released otherwise.
+			if i > 0 && ptr.Deref(service.Spec.IPFamilyPolicy, corev1.IPFamilyPolicySingleStack) == corev1.IPFamilyPolicyPreferDualStack {
+				log.Info("Unable to allocate secondary IP family", "IPFamily", family, "Error", err)
+				continue
+			}
+			log.V(1).Info("Unable to allocate IP, requeueing", "IPFamily", family, "Error", err)
+			if err := r.patchCondition(ctx, service, metalloadbalancerv1alpha1.ServiceIPAllocatedCondition, metav1.ConditionFalse, "AllocationFailed", err.Error()); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: allocationRequeueInterval}, nil
+		}
+		serviceIPs = append(serviceIPs, serviceIP)
+		ingress = append(ingress, corev1.LoadBalancerIngress{
+			IP: serviceIP.String(),
+		})
+	}
+
+	// Release addresses the Service no longer uses, e.g. of dropped IP families or replaced by a requested IP.
+	if err := r.releaseServiceIPs(ctx, log, service, serviceIPs...); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Auto-allocated addresses never conflict, as allocation skips addresses in use. Requested addresses are
+	// refused instead.
+	for _, serviceIP := range requestedIPs {
+		if !slices.Contains(serviceIPs, serviceIP) {
+			continue
+		}
+		conflicting, err := r.findConflictingService(ctx, service, serviceIP)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if conflicting == nil {
+			continue
+		}
+
+		message := fmt.Sprintf("IP %s is already in use by Service %s/%s", serviceIP, conflicting.Namespace, conflicting.Name)
+		r.Recorder.Eventf(service, nil, corev1.EventTypeWarning, "IPConflict", "PublishIP", "%s", message)
+		if err := r.patchCondition(ctx, service, metalloadbalancerv1alpha1.ServiceIPConflictCondition, metav1.ConditionTrue, "IPInUse", message); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, fmt.Errorf("refusing to publish conflicting IP: %s", message)
+	}
+	if err := r.patchCondition(ctx, service, metalloadbalancerv1alpha1.ServiceIPConflictCondition, metav1.ConditionFalse, "NoConflict", "No IP of the Service is in use by another Service"); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	serviceBase := service.DeepCopy()
+	service.Status.LoadBalancer.Ingress = ingress
 	if err := r.Status().Patch(ctx, service, client.MergeFrom(serviceBase)); err != nil {
 		return ctrl.Result{}, err
 	}
+
+	ips := make([]string, 0, len(serviceIPs))
+	for _, serviceIP := range serviceIPs {
+		ips = append(ips, serviceIP.String())
+	}
+	if !equality.Semantic.DeepEqual(serviceBase.Status.LoadBalancer.Ingress, ingress) {
+		r.Recorder.Eventf(service, nil, corev1.EventTypeNormal, "IPAllocated", "AllocateIP", "Allocated IPs %s", strings.Join(ips, ", "))
+	}
+	if err := r.patchCondition(ctx, service, metalloadbalancerv1alpha1.ServiceIPAllocatedCondition, metav1.ConditionTrue, "Allocated",
+		fmt.Sprintf("Allocated IPs %s", strings.Join(ips, ", "))); err != nil {
+		return ctrl.Result{}, err
+	}
 	return ctrl.Result{}, nil
 }
 
-func generateServiceIP(service *corev1.Service) (string, error) {
-	ip, err := netip.ParseAddr(service.Spec.ClusterIP)
-	if err != nil {
-		return "", fmt.Errorf("invalid ClusterIP format: %w", err)
+// findConflictingService returns the Service, if any, other than the given one that uses the given IP as
+// ClusterIP or LoadBalancer ingress IP.
+func (r *ServiceReconciler) findConflictingService(ctx context.Context, service *corev1.Service, ip netip.Addr) (*corev1.Service, error) {
+	serviceList := &corev1.ServiceList{}
+	if err := r.List(ctx, serviceList, client.MatchingFields{serviceIPsField: ip.String()}); err != nil {
+		return nil, fmt.Errorf("failed to list Services using IP %s: %w", ip, err)
+	}
+
+	for i := range serviceList.Items {
+		if serviceList.Items[i].UID != service.UID {
+			return &serviceList.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// patchCondition sets the condition of the given type on the Service.
+func (r *ServiceReconciler) patchCondition(ctx context.Context, service *corev1.Service, conditionType string, status metav1.ConditionStatus, reason, message string) error {
+	_, err := serviceutils.PatchServiceCondition(ctx, r.Client, service, metav1.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+	return err
+}
+
+// serviceIPFamilies returns the IP families of the given Service with the primary family first.
+func serviceIPFamilies(service *corev1.Service) ([]corev1.IPFamily, error) {
+	if len(service.Spec.IPFamilies) > 0 {
+		return service.Spec.IPFamilies, nil
+	}
+
+	clusterIPs := service.Spec.ClusterIPs
+	if len(clusterIPs) == 0 {
+		clusterIPs = []string{service.Spec.ClusterIP}
+	}
+
+	families := make([]corev1.IPFamily, 0, len(clusterIPs))
+	for _, clusterIP := range clusterIPs {
+		ip, err := netip.ParseAddr(clusterIP)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ClusterIP format: %w", err)
+		}
+		if ip.Is4() {
+			families = append(families, corev1.IPv4Protocol)
+		} else {
+			families = append(families, corev1.IPv6Protocol)
+		}
 	}
-	if ip.Is4() {
-		return "", fmt.Errorf("IPv4 is not supported")
+	return families, nil
+}
+
+// serviceRequestedIPs returns the addresses requested for the given Service by IP family. The
+// ServiceIPAnnotation takes precedence over spec.loadBalancerIP.
+func serviceRequestedIPs(service *corev1.Service, families []corev1.IPFamily) (map[corev1.IPFamily]netip.Addr, error) {
+	value, ok := service.Annotations[metalloadbalancerv1alpha1.ServiceIPAnnotation]
+	if !ok {
+		value = service.Spec.LoadBalancerIP
+	}
+	if value == "" {
+		return nil, nil
 	}
 
-	b := ip.As16()
-	// add plus one to the 14th byte to get a new IP for the service
-	b[13]++
+	requestedIPs := make(map[corev1.IPFamily]netip.Addr)
+	for _, ip := range strings.Split(value, ",") {
+		addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+		if err != nil {
+			return nil, fmt.Errorf("invalid requested IP %q: %w", ip, err)
+		}
 
-	if b[13] == 0 {
-		return "", fmt.Errorf("unsupported service range")
+		family := corev1.IPv6Protocol
+		if addr.Is4() {
+			family = corev1.IPv4Protocol
+		}
+		if !slices.Contains(families, family) {
+			return nil, fmt.Errorf("requested IP %s does not match the IP families of the Service", addr)
+		}
+		if _, ok := requestedIPs[family]; ok {
+			return nil, fmt.Errorf("multiple %s addresses requested", family)
+		}
+		requestedIPs[family] = addr
 	}
-	return netip.AddrFrom16(b).String(), nil
+	return requestedIPs, nil
+}
+
+func (r *ServiceReconciler) enqueueLoadBalancerServices(ctx context.Context, _ client.Object) []ctrl.Request {
+	log := ctrl.LoggerFrom(ctx)
+	serviceList := &corev1.ServiceList{}
+	if err := r.List(ctx, serviceList); err != nil {
+		log.Error(err, "failed to list Services")
+		return nil
+	}
+
+	var reqs []ctrl.Request
+	for _, service := range serviceList.Items {
+		if r.isManagedLoadBalancer(&service) {
+			reqs = append(reqs, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&service)})
+		}
+	}
+	return reqs
+}
+
+func (r *ServiceReconciler) enqueueNamespaceLoadBalancerServices(ctx context.Context, obj client.Object) []ctrl.Request {
+	log := ctrl.LoggerFrom(ctx)
+	serviceList := &corev1.ServiceList{}
+	if err := r.List(ctx, serviceList, client.InNamespace(obj.GetName())); err != nil {
+		log.Error(err, "failed to list Services", "Namespace", obj.GetName())
+		return nil
+	}
+
+	var reqs []ctrl.Request
+	for _, service := range serviceList.Items {
+		if r.isManagedLoadBalancer(&service) {
+			reqs = append(reqs, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&service)})
+		}
+	}
+	return reqs
+}
+
+func (r *ServiceReconciler) isManagedLoadBalancer(service *corev1.Service) bool {
+	return service.Spec.Type == corev1.ServiceTypeLoadBalancer &&
+		serviceutils.MatchesLoadBalancerClass(service, r.LoadBalancerClass, r.IncludeServicesWithoutClass)
+}
+
+// serviceIPsField indexes Services by their ClusterIPs and LoadBalancer ingress IPs.
+const serviceIPsField = "service.ips"
+
+func indexServiceIPs(obj client.Object) []string {
+	service := obj.(*corev1.Service)
+
+	candidates := slices.Clone(service.Spec.ClusterIPs)
+	candidates = append(candidates, service.Spec.ClusterIP)
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		candidates = append(candidates, ingress.IP)
+	}
+
+	var ips []string
+	for _, ip := range candidates {
+		// Normalize the IPs so that they match the addresses allocated from the pools.
+		if addr, err := netip.ParseAddr(ip); err == nil && !slices.Contains(ips, addr.String()) {
+			ips = append(ips, addr.String())
+		}
+	}
+	return ips
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &corev1.Service{}, serviceIPsField, indexServiceIPs); err != nil {
+		return err
+	}
+	if err := metrics.Registry.Register(&poolCollector{client: mgr.GetClient()}); err != nil {
+		return fmt.Errorf("failed to register LoadBalancerIPPool metrics: %w", err)
+	}
+	interval := r.AllocationGCInterval
+	if interval == 0 {
+		interval = DefaultAllocationGCInterval
+	}
+	if err := mgr.Add(&allocationGarbageCollector{reconciler: r, interval: interval}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Service{}).
+		Watches(
+			&metalloadbalancerv1alpha1.LoadBalancerIPPool{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueLoadBalancerServices),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		// VNIMappings and the labels of Namespaces define the LoadBalancerIPPool of the Services.
+		Watches(
+			&metalloadbalancerv1alpha1.VNIMapping{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueLoadBalancerServices),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueNamespaceLoadBalancerServices),
+			builder.WithPredicates(predicate.LabelChangedPredicate{}),
+		).
 		Complete(r)
 }
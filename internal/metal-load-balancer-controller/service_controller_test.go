@@ -0,0 +1,535 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metal_load_balancer_controller
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	gomegatypes "github.com/onsi/gomega/types"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
+)
+
+var _ = Describe("ServiceReconciler", func() {
+	ns := SetupTest()
+
+	Context("LoadBalancerIPPool allocation", func() {
+		It("should allocate the first free address of the pool", func(ctx SpecContext) {
+			pool := createPool(ctx, "192.0.2.0/24")
+
+			By("creating a LoadBalancer Service")
+			service := createLoadBalancerService(ctx, ns.Name)
+
+			By("publishing the first usable address of the pool")
+			Eventually(Object(service)).Should(SatisfyAll(
+				HaveField("Finalizers", ContainElement(AllocationFinalizer)),
+				HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "192.0.2.1"))),
+				HaveField("Status.Conditions", ContainElement(SatisfyAll(
+					HaveField("Type", metalloadbalancerv1alpha1.ServiceIPAllocatedCondition),
+					HaveField("Status", metav1.ConditionTrue),
+				))),
+			))
+
+			By("recording the allocation in the pool")
+			Eventually(Object(pool)).Should(HaveField("Status.Allocations", ConsistOf(metalloadbalancerv1alpha1.IPAllocation{
+				IP: "192.0.2.1",
+				ServiceRef: metalloadbalancerv1alpha1.ServiceReference{
+					Namespace: service.Namespace,
+					Name:      service.Name,
+					UID:       service.UID,
+				},
+			})))
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(service, "IPAllocated"))
+
+			By("allocating the next address to another Service")
+			other := createLoadBalancerService(ctx, ns.Name)
+			Eventually(Object(other)).Should(HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "192.0.2.2"))))
+		})
+
+		It("should release the address once the Service is deleted", func(ctx SpecContext) {
+			pool := createPool(ctx, "192.0.2.0/24")
+			service := createLoadBalancerService(ctx, ns.Name)
+			Eventually(Object(pool)).Should(HaveField("Status.Allocations", HaveLen(1)))
+
+			By("deleting the Service")
+			Expect(k8sClient.Delete(ctx, service)).To(Succeed())
+
+			By("releasing the allocation and removing the finalizer")
+			Eventually(Object(pool)).Should(HaveField("Status.Allocations", BeEmpty()))
+			Eventually(Get(service)).Should(Satisfy(apierrors.IsNotFound))
+		})
+
+		It("should release allocations of Services that no longer exist", func(ctx SpecContext) {
+			pool := createPool(ctx, "192.0.2.0/24")
+			service := createLoadBalancerService(ctx, ns.Name)
+			Eventually(Object(pool)).Should(HaveField("Status.Allocations", HaveLen(1)))
+
+			By("recording an allocation of a Service that does not exist")
+			Eventually(UpdateStatus(pool, func() {
+				pool.Status.Allocations = append(pool.Status.Allocations, metalloadbalancerv1alpha1.IPAllocation{
+					IP: "192.0.2.100",
+					ServiceRef: metalloadbalancerv1alpha1.ServiceReference{
+						Namespace: ns.Name,
+						Name:      "gone",
+						UID:       "00000000-0000-0000-0000-000000000000",
+					},
+				})
+			})).Should(Succeed())
+
+			By("releasing only the orphaned allocation")
+			Eventually(Object(pool)).Should(HaveField("Status.Allocations", ConsistOf(
+				HaveField("ServiceRef.UID", service.UID),
+			)))
+		})
+
+		It("should allocate a new address if the pool of the Service is deleted", func(ctx SpecContext) {
+			pool := createPool(ctx, "192.0.2.0/24")
+			service := createLoadBalancerService(ctx, ns.Name)
+			Eventually(Object(service)).Should(HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "192.0.2.1"))))
+
+			By("replacing the pool")
+			Expect(k8sClient.Delete(ctx, pool)).To(Succeed())
+			newPool := createPool(ctx, "198.51.100.0/24")
+
+			By("allocating an address of the new pool")
+			Eventually(Object(service)).Should(HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "198.51.100.1"))))
+			Eventually(Object(newPool)).Should(HaveField("Status.Allocations", ConsistOf(
+				HaveField("ServiceRef.UID", service.UID),
+			)))
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(service, "AllocationLost"))
+		})
+	})
+
+	Context("conditions and events", func() {
+		It("should report whether an address could be allocated", func(ctx SpecContext) {
+			service := createLoadBalancerService(ctx, ns.Name)
+
+			By("reporting the missing pool")
+			Eventually(Object(service)).Should(HaveField("Status.Conditions", ContainElement(SatisfyAll(
+				HaveField("Type", metalloadbalancerv1alpha1.ServiceIPAllocatedCondition),
+				HaveField("Status", metav1.ConditionFalse),
+				HaveField("Reason", "AllocationFailed"),
+			))))
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(service, "PoolExhausted"))
+
+			By("creating a pool")
+			createPool(ctx, "192.0.2.0/24")
+			Eventually(Object(service)).Should(HaveField("Status.Conditions", ContainElements(
+				SatisfyAll(
+					HaveField("Type", metalloadbalancerv1alpha1.ServiceIPAllocatedCondition),
+					HaveField("Status", metav1.ConditionTrue),
+					HaveField("Reason", "Allocated"),
+				),
+				SatisfyAll(
+					HaveField("Type", metalloadbalancerv1alpha1.ServiceIPConflictCondition),
+					HaveField("Status", metav1.ConditionFalse),
+				),
+			)))
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(service, "IPAllocated"))
+		})
+	})
+
+	Context("VNIMappings", func() {
+		It("should re-allocate the address from the LoadBalancerIPPool of the VNIMapping", func(ctx SpecContext) {
+			createPool(ctx, "192.0.2.0/24")
+			service := createLoadBalancerService(ctx, ns.Name)
+			Eventually(Object(service)).Should(HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "192.0.2.1"))))
+
+			By("mapping the namespace to another pool")
+			mappedPool := createPool(ctx, "198.51.100.0/24")
+			createVNIMapping(ctx, metalloadbalancerv1alpha1.VNIMappingSpec{
+				Namespaces: []string{ns.Name},
+				VNI:        200,
+				IPPoolRef:  &corev1.LocalObjectReference{Name: mappedPool.Name},
+			})
+
+			By("replacing the address with one of the mapped pool")
+			Eventually(Object(service)).Should(HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "198.51.100.1"))))
+			Eventually(Object(mappedPool)).Should(HaveField("Status.Allocations", ConsistOf(
+				HaveField("ServiceRef.UID", service.UID),
+			)))
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(service, "PoolMismatch"))
+
+			By("allocating addresses of new Services from the mapped pool")
+			other := createLoadBalancerService(ctx, ns.Name)
+			Eventually(Object(other)).Should(HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "198.51.100.2"))))
+		})
+
+		It("should keep the address while the mapped pool is exhausted", func(ctx SpecContext) {
+			createPool(ctx, "192.0.2.0/24")
+			service := createLoadBalancerService(ctx, ns.Name)
+			Eventually(Object(service)).Should(HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "192.0.2.1"))))
+
+			By("mapping the namespace to a pool without free addresses")
+			mappedPool := createPool(ctx, "198.51.100.1/32")
+			mappedPool.Spec.Exclusions = []string{"198.51.100.1"}
+			Expect(k8sClient.Update(ctx, mappedPool)).To(Succeed())
+			createVNIMapping(ctx, metalloadbalancerv1alpha1.VNIMappingSpec{
+				Namespaces: []string{ns.Name},
+				VNI:        200,
+				IPPoolRef:  &corev1.LocalObjectReference{Name: mappedPool.Name},
+			})
+
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(service, "PoolMismatch"))
+			Consistently(Object(service)).Should(HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "192.0.2.1"))))
+		})
+	})
+
+	Context("requested addresses", func() {
+		It("should allocate the address requested by the annotation or spec.loadBalancerIP", func(ctx SpecContext) {
+			pool := createPool(ctx, "192.0.2.0/24")
+
+			annotated := createLoadBalancerService(ctx, ns.Name, func(service *corev1.Service) {
+				service.Annotations = map[string]string{metalloadbalancerv1alpha1.ServiceIPAnnotation: "192.0.2.10"}
+			})
+			Eventually(Object(annotated)).Should(HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "192.0.2.10"))))
+
+			requested := createLoadBalancerService(ctx, ns.Name, func(service *corev1.Service) {
+				service.Spec.LoadBalancerIP = "192.0.2.20"
+			})
+			Eventually(Object(requested)).Should(HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "192.0.2.20"))))
+
+			Eventually(Object(pool)).Should(HaveField("Status.Allocations", ConsistOf(
+				SatisfyAll(HaveField("IP", "192.0.2.10"), HaveField("ServiceRef.UID", annotated.UID)),
+				SatisfyAll(HaveField("IP", "192.0.2.20"), HaveField("ServiceRef.UID", requested.UID)),
+			)))
+
+			By("replacing the requested address")
+			Eventually(Update(annotated, func() {
+				annotated.Annotations[metalloadbalancerv1alpha1.ServiceIPAnnotation] = "192.0.2.11"
+			})).Should(Succeed())
+			Eventually(Object(annotated)).Should(HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "192.0.2.11"))))
+			Eventually(Object(pool)).Should(HaveField("Status.Allocations", ConsistOf(
+				HaveField("IP", "192.0.2.11"),
+				HaveField("IP", "192.0.2.20"),
+			)))
+		})
+
+		It("should refuse addresses outside of the pools", func(ctx SpecContext) {
+			createPool(ctx, "192.0.2.0/24")
+
+			service := createLoadBalancerService(ctx, ns.Name, func(service *corev1.Service) {
+				service.Spec.LoadBalancerIP = "198.51.100.1"
+			})
+			Eventually(Object(service)).Should(HaveField("Status.Conditions", ContainElement(SatisfyAll(
+				HaveField("Type", metalloadbalancerv1alpha1.ServiceIPAllocatedCondition),
+				HaveField("Status", metav1.ConditionFalse),
+				HaveField("Reason", "AllocationFailed"),
+			))))
+			Expect(Object(service)()).To(HaveField("Status.LoadBalancer.Ingress", BeEmpty()))
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(service, "RequestedIPNotAllowed"))
+		})
+
+		It("should refuse addresses allocated to another Service", func(ctx SpecContext) {
+			createPool(ctx, "192.0.2.0/24")
+
+			first := createLoadBalancerService(ctx, ns.Name, func(service *corev1.Service) {
+				service.Spec.LoadBalancerIP = "192.0.2.10"
+			})
+			Eventually(Object(first)).Should(HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "192.0.2.10"))))
+
+			second := createLoadBalancerService(ctx, ns.Name, func(service *corev1.Service) {
+				service.Spec.LoadBalancerIP = "192.0.2.10"
+			})
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(second, "RequestedIPInUse"))
+			Consistently(Object(second)).Should(HaveField("Status.LoadBalancer.Ingress", BeEmpty()))
+		})
+
+		It("should refuse to publish the ClusterIP of another Service", func(ctx SpecContext) {
+			clusterIP := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ns.Name, GenerateName: "cluster-ip-"},
+				Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+			}
+			Expect(k8sClient.Create(ctx, clusterIP)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, clusterIP)
+			createPool(ctx, "10.0.0.0/24")
+
+			service := createLoadBalancerService(ctx, ns.Name, func(service *corev1.Service) {
+				service.Spec.LoadBalancerIP = clusterIP.Spec.ClusterIP
+			})
+			Eventually(Object(service)).Should(HaveField("Status.Conditions", ContainElement(SatisfyAll(
+				HaveField("Type", metalloadbalancerv1alpha1.ServiceIPConflictCondition),
+				HaveField("Status", metav1.ConditionTrue),
+				HaveField("Reason", "IPInUse"),
+			))))
+			Expect(Object(service)()).To(HaveField("Status.LoadBalancer.Ingress", BeEmpty()))
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(service, "IPConflict"))
+		})
+
+		It("should report invalid requested addresses", func(ctx SpecContext) {
+			createPool(ctx, "192.0.2.0/24")
+
+			service := createLoadBalancerService(ctx, ns.Name, func(service *corev1.Service) {
+				service.Annotations = map[string]string{metalloadbalancerv1alpha1.ServiceIPAnnotation: "192.0.2.256"}
+			})
+			Eventually(Object(service)).Should(HaveField("Status.Conditions", ContainElement(SatisfyAll(
+				HaveField("Type", metalloadbalancerv1alpha1.ServiceIPAllocatedCondition),
+				HaveField("Status", metav1.ConditionFalse),
+				HaveField("Reason", "InvalidRequestedIP"),
+			))))
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(service, "InvalidRequestedIP"))
+		})
+	})
+
+	Context("Services that stop being LoadBalancers", func() {
+		It("should clear the status, release the address and remove the finalizer", func(ctx SpecContext) {
+			pool := createPool(ctx, "192.0.2.0/24")
+			service := createLoadBalancerService(ctx, ns.Name)
+			Eventually(Object(service)).Should(SatisfyAll(
+				HaveField("Finalizers", ContainElement(AllocationFinalizer)),
+				HaveField("Status.LoadBalancer.Ingress", HaveLen(1)),
+			))
+
+			By("changing the Service to a ClusterIP Service")
+			Eventually(Update(service, func() {
+				service.Spec.Type = corev1.ServiceTypeClusterIP
+			})).Should(Succeed())
+
+			Eventually(Object(service)).Should(SatisfyAll(
+				HaveField("Finalizers", Not(ContainElement(AllocationFinalizer))),
+				HaveField("Status.LoadBalancer.Ingress", BeEmpty()),
+				HaveField("Status.Conditions", BeEmpty()),
+			))
+			Eventually(Object(pool)).Should(HaveField("Status.Allocations", BeEmpty()))
+		})
+
+		It("should keep the address until the speakers withdrew their routes", func(ctx SpecContext) {
+			pool := createPool(ctx, "192.0.2.0/24")
+			const nodeFinalizer = "speaker.metal-loadbalancer.ironcore.dev/node"
+			service := createLoadBalancerService(ctx, ns.Name, func(service *corev1.Service) {
+				service.Finalizers = []string{nodeFinalizer}
+			})
+			Eventually(Object(service)).Should(HaveField("Status.LoadBalancer.Ingress", HaveLen(1)))
+
+			By("changing the Service to a ClusterIP Service")
+			Eventually(Update(service, func() {
+				service.Spec.Type = corev1.ServiceTypeClusterIP
+			})).Should(Succeed())
+			Eventually(Object(service)).Should(HaveField("Status.LoadBalancer.Ingress", BeEmpty()))
+			Consistently(Object(pool)).Should(HaveField("Status.Allocations", HaveLen(1)))
+
+			By("removing the finalizer of the speaker")
+			Eventually(Update(service, func() {
+				service.Finalizers = slices.DeleteFunc(service.Finalizers, func(finalizer string) bool {
+					return finalizer == nodeFinalizer
+				})
+			})).Should(Succeed())
+			Eventually(Object(pool)).Should(HaveField("Status.Allocations", BeEmpty()))
+			Eventually(Object(service)).Should(HaveField("Finalizers", BeEmpty()))
+		})
+	})
+
+	Context("load balancer classes", func() {
+		It("should only handle Services without a class", func(ctx SpecContext) {
+			createPool(ctx, "192.0.2.0/24")
+
+			By("creating a Service of another class")
+			other := createLoadBalancerService(ctx, ns.Name, func(service *corev1.Service) {
+				service.Spec.LoadBalancerClass = ptr.To("example.com/other")
+			})
+
+			By("creating a Service without a class")
+			service := createLoadBalancerService(ctx, ns.Name)
+			Eventually(Object(service)).Should(HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "192.0.2.1"))))
+
+			By("leaving the Service of the other class alone")
+			Consistently(Object(other)).Should(SatisfyAll(
+				HaveField("Finalizers", BeEmpty()),
+				HaveField("Status.LoadBalancer.Ingress", BeEmpty()),
+				HaveField("Status.Conditions", BeEmpty()),
+			))
+		})
+
+		It("should not remove finalizers of another instance", func(ctx SpecContext) {
+			other := createLoadBalancerService(ctx, ns.Name, func(service *corev1.Service) {
+				service.Spec.LoadBalancerClass = ptr.To("example.com/other")
+				service.Finalizers = []string{AllocationFinalizer}
+			})
+			DeferCleanup(func(ctx SpecContext) {
+				Eventually(Update(other, func() {
+					other.Finalizers = nil
+				})).Should(Succeed())
+			})
+
+			Consistently(Object(other)).Should(HaveField("Finalizers", ConsistOf(AllocationFinalizer)))
+		})
+	})
+
+	Context("dual-stack Services", func() {
+		It("should publish an address of each IP family", func(ctx SpecContext) {
+			createPool(ctx, "192.0.2.0/24", "2001:db8::/64")
+
+			service := createLoadBalancerService(ctx, ns.Name, func(service *corev1.Service) {
+				service.Spec.IPFamilyPolicy = ptr.To(corev1.IPFamilyPolicyRequireDualStack)
+				service.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv6Protocol, corev1.IPv4Protocol}
+			})
+
+			By("publishing one ingress entry per IP family, the primary family first")
+			Eventually(Object(service)).Should(HaveField("Status.LoadBalancer.Ingress", HaveExactElements(
+				HaveField("IP", "2001:db8::"),
+				HaveField("IP", "192.0.2.1"),
+			)))
+		})
+
+		It("should fall back to the primary IP family of PreferDualStack Services", func(ctx SpecContext) {
+			pool := createPool(ctx, "192.0.2.0/24")
+
+			service := createLoadBalancerService(ctx, ns.Name, func(service *corev1.Service) {
+				service.Spec.IPFamilyPolicy = ptr.To(corev1.IPFamilyPolicyPreferDualStack)
+				service.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol}
+			})
+
+			By("publishing the IPv4 address while no pool has IPv6 addresses")
+			Eventually(Object(service)).Should(SatisfyAll(
+				HaveField("Status.LoadBalancer.Ingress", ConsistOf(HaveField("IP", "192.0.2.1"))),
+				HaveField("Status.Conditions", ContainElement(SatisfyAll(
+					HaveField("Type", metalloadbalancerv1alpha1.ServiceIPAllocatedCondition),
+					HaveField("Status", metav1.ConditionTrue),
+				))),
+			))
+
+			By("adding an IPv6 CIDR to the pool")
+			Eventually(Update(pool, func() {
+				pool.Spec.CIDRs = append(pool.Spec.CIDRs, "2001:db8::/64")
+			})).Should(Succeed())
+			Eventually(Object(service)).Should(HaveField("Status.LoadBalancer.Ingress", HaveExactElements(
+				HaveField("IP", "192.0.2.1"),
+				HaveField("IP", "2001:db8::"),
+			)))
+		})
+
+		It("should keep the secondary address of PreferDualStack Services on transient errors", func(ctx SpecContext) {
+			pool := createPool(ctx, "192.0.2.0/24", "2001:db8::/64")
+
+			// The Service is of a class the reconciler of the suite ignores, so that the spec controls
+			// the reconciliations.
+			const class = "example.com/prefer-dual-stack"
+			service := createLoadBalancerService(ctx, ns.Name, func(service *corev1.Service) {
+				service.Spec.LoadBalancerClass = ptr.To(class)
+				service.Spec.IPFamilyPolicy = ptr.To(corev1.IPFamilyPolicyPreferDualStack)
+				service.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol}
+			})
+			reconcile := func(c client.Client) error {
+				r := &ServiceReconciler{
+					Client:            c,
+					Scheme:            k8sManager.GetScheme(),
+					Recorder:          k8sManager.GetEventRecorder("metal-load-balancer-controller"),
+					LoadBalancerClass: class,
+				}
+				_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(service)})
+				return err
+			}
+
+			By("allocating an address of each IP family")
+			Eventually(func(g Gomega) {
+				g.Expect(reconcile(k8sManager.GetClient())).To(Succeed())
+				g.Expect(Object(service)()).To(HaveField("Status.LoadBalancer.Ingress", HaveLen(2)))
+			}).Should(Succeed())
+
+			By("failing to look up the IPv6 address")
+			Expect(reconcile(&ipv6LookupFailingClient{Client: k8sManager.GetClient()})).To(MatchError(errIPv6LookupFailed))
+
+			By("keeping the IPv6 allocation")
+			Consistently(Object(pool)).Should(HaveField("Status.Allocations", ConsistOf(
+				HaveField("IP", "192.0.2.1"),
+				HaveField("IP", "2001:db8::"),
+			)))
+			Expect(Object(service)()).To(HaveField("Status.LoadBalancer.Ingress", HaveLen(2)))
+
+			By("cleaning up the Service")
+			Expect(k8sClient.Delete(ctx, service)).To(Succeed())
+			Eventually(func(g Gomega) {
+				g.Expect(reconcile(k8sManager.GetClient())).To(Succeed())
+				g.Expect(Get(service)()).To(Satisfy(apierrors.IsNotFound))
+			}).Should(Succeed())
+		})
+	})
+})
+
+var errIPv6LookupFailed = errors.New("IPv6 lookup failed")
+
+// ipv6LookupFailingClient fails to list the Services using an IPv6 address.
+type ipv6LookupFailingClient struct {
+	client.Client
+}
+
+func (c *ipv6LookupFailingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	if listOpts.FieldSelector != nil {
+		if ip, ok := listOpts.FieldSelector.RequiresExactMatch(serviceIPsField); ok && strings.Contains(ip, ":") {
+			return errIPv6LookupFailed
+		}
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+// createPool creates a LoadBalancerIPPool with the given CIDRs, which is deleted at the end of the spec.
+func createPool(ctx context.Context, cidrs ...string) *metalloadbalancerv1alpha1.LoadBalancerIPPool {
+	pool := &metalloadbalancerv1alpha1.LoadBalancerIPPool{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "pool-"},
+		Spec:       metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: cidrs},
+	}
+	Expect(k8sClient.Create(ctx, pool)).To(Succeed())
+	DeferCleanup(func(ctx context.Context) error {
+		return client.IgnoreNotFound(k8sClient.Delete(ctx, pool))
+	})
+	return pool
+}
+
+// createVNIMapping creates a VNIMapping with the given spec, which is deleted at the end of the spec.
+func createVNIMapping(ctx context.Context, spec metalloadbalancerv1alpha1.VNIMappingSpec) *metalloadbalancerv1alpha1.VNIMapping {
+	mapping := &metalloadbalancerv1alpha1.VNIMapping{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "mapping-"},
+		Spec:       spec,
+	}
+	Expect(k8sClient.Create(ctx, mapping)).To(Succeed())
+	DeferCleanup(func(ctx context.Context) error {
+		return client.IgnoreNotFound(k8sClient.Delete(ctx, mapping))
+	})
+	return mapping
+}
+
+// createLoadBalancerService creates a LoadBalancer Service in the namespace after applying the given mutations.
+// The Service is deleted at the end of the spec, and the spec waits until its finalizers are removed.
+func createLoadBalancerService(ctx context.Context, namespace string, mutate ...func(*corev1.Service)) *corev1.Service {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:    namespace,
+			GenerateName: "service-",
+		},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{{Name: "http", Port: 80}},
+		},
+	}
+	for _, f := range mutate {
+		f(service)
+	}
+	Expect(k8sClient.Create(ctx, service)).To(Succeed())
+	DeferCleanup(func(ctx context.Context) {
+		Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, service))).To(Succeed())
+		Eventually(Get(service)).Should(Satisfy(apierrors.IsNotFound))
+	})
+	return service
+}
+
+// haveEvent matches an EventList containing an event with the given reason regarding the Service.
+func haveEvent(service *corev1.Service, reason string) gomegatypes.GomegaMatcher {
+	return HaveField("Items", ContainElement(SatisfyAll(
+		HaveField("Regarding.UID", service.UID),
+		HaveField("Reason", reason),
+	)))
+}
@@ -0,0 +1,335 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"github.com/go-logr/logr"
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	"github.com/ironcore-dev/metal-load-balancer-controller/internal/prefixutils"
+	"github.com/ironcore-dev/metalbond"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// poolRoutesKey returns the key the routes of an aggregated LoadBalancerIPPool are recorded with. As pools
+// are cluster-scoped, the key never collides with the key of a Service.
+func poolRoutesKey(poolName string) types.NamespacedName {
+	return types.NamespacedName{Name: poolName}
+}
+
+func isPoolRoutesKey(key types.NamespacedName) bool {
+	return key.Namespace == ""
+}
+
+// coveredByAggregate reports whether an address of the Service allocated from the given pool is covered by the
+// aggregated routes of the pool. Services with their own next hop, VNI or set of announcing nodes are not.
+func (r *ServiceReconciler) coveredByAggregate(
+	ctx context.Context,
+	service *corev1.Service,
+	pool *metalloadbalancerv1alpha1.LoadBalancerIPPool,
+	vni metalbond.VNI,
+	annotatedSpec *metalloadbalancerv1alpha1.NextHop,
+) (bool, error) {
+	if annotatedSpec != nil || vni != metalbond.VNI(r.VNI) {
+		return false, nil
+	}
+	if service.Spec.ExternalTrafficPolicy == corev1.ServiceExternalTrafficPolicyLocal {
+		return false, nil
+	}
+	if _, ok := service.Annotations[metalloadbalancerv1alpha1.ServiceNodeSelectorAnnotation]; ok {
+		return false, nil
+	}
+	return r.isAggregated(ctx, pool)
+}
+
+// isAggregated reports whether the CIDRs of the pool are announced instead of its addresses. The aggregated
+// routes are announced in the default VNI, so pools of VNIMappings with another VNI are never aggregated.
+func (r *ServiceReconciler) isAggregated(ctx context.Context, pool *metalloadbalancerv1alpha1.LoadBalancerIPPool) (bool, error) {
+	if pool == nil || !pool.Spec.Aggregate {
+		return false, nil
+	}
+
+	mappingList := &metalloadbalancerv1alpha1.VNIMappingList{}
+	if err := r.List(ctx, mappingList); err != nil {
+		return false, fmt.Errorf("failed to list VNIMappings: %w", err)
+	}
+	for _, mapping := range mappingList.Items {
+		if mapping.Spec.IPPoolRef != nil && mapping.Spec.IPPoolRef.Name == pool.Name && mapping.Spec.VNI != int32(r.VNI) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// aggregatedRoutes returns the aggregated routes of the pool announced by this node that cover the destination.
+func (r *ServiceReconciler) aggregatedRoutes(pool *metalloadbalancerv1alpha1.LoadBalancerIPPool, dest metalbond.Destination) sets.Set[Route] {
+	routes := sets.New[Route]()
+	for _, route := range r.Routes.Get(poolRoutesKey(pool.Name)).UnsortedList() {
+		if route.Dest.Prefix.Contains(dest.Prefix.Addr()) {
+			routes.Insert(route)
+		}
+	}
+	return routes
+}
+
+// reconcileAggregate announces the CIDRs of an aggregated LoadBalancerIPPool. The Services of the pool are
+// queued whenever the aggregated routes change, so that they report the routes covering them.
+func (r *ServiceReconciler) reconcileAggregate(ctx context.Context, req ctrl.Request, events chan<- event.GenericEvent) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+	key := poolRoutesKey(req.Name)
+
+	pool := &metalloadbalancerv1alpha1.LoadBalancerIPPool{}
+	if err := r.Get(ctx, req.NamespacedName, pool); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.withdrawRoutes(log, key, r.Routes.Get(key))
+	}
+
+	routes := sets.New[Route]()
+	announce, carveOuts, err := r.servesAggregate(ctx, log, pool)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if announce {
+		if err := anyPeerEstablished(r.Peers); err != nil {
+			log.V(1).Info("Metalbond session is not established, requeueing", "Reason", err.Error())
+			return ctrl.Result{RequeueAfter: sessionRequeueInterval}, nil
+		}
+
+		if routes, err = r.poolRoutes(ctx, pool, carveOuts); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	announced := r.Routes.Get(key)
+	if err := r.applyRoutes(log, key, routes); err != nil {
+		return ctrl.Result{}, err
+	}
+	if !announced.Equal(routes) {
+		enqueuePoolServices(ctx, pool, events)
+	}
+	return ctrl.Result{}, nil
+}
+
+// enqueuePoolServices sends an event for each Service with an address allocated from the pool.
+func enqueuePoolServices(ctx context.Context, pool *metalloadbalancerv1alpha1.LoadBalancerIPPool, events chan<- event.GenericEvent) {
+	for _, allocation := range pool.Status.Allocations {
+		evt := event.GenericEvent{
+			Object: &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+				Namespace: allocation.ServiceRef.Namespace,
+				Name:      allocation.ServiceRef.Name,
+			}},
+		}
+		select {
+		case events <- evt:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// servesAggregate reports whether this node has to announce the aggregated routes of the pool, i.e. whether
+// it would announce any Service with an address of the pool that is covered by the aggregated routes. It also
+// returns the allocated addresses of Services that are not covered, e.g. as they are announced in another VNI or
+// by other nodes. These are carved out of the aggregated routes, so that the node only attracts traffic for
+// addresses it serves and never leaks traffic of other VNIs into the default one.
+func (r *ServiceReconciler) servesAggregate(
+	ctx context.Context,
+	log logr.Logger,
+	pool *metalloadbalancerv1alpha1.LoadBalancerIPPool,
+) (bool, []netip.Prefix, error) {
+	if !pool.DeletionTimestamp.IsZero() {
+		return false, nil, nil
+	}
+	if ok, err := r.isAggregated(ctx, pool); err != nil || !ok {
+		return false, nil, err
+	}
+	// Covered Services have no node selector annotation, so they are announced by the nodes of the speaker.
+	if ok, err := r.nodeMatches(ctx, r.NodeSelector); err != nil || !ok {
+		return false, nil, err
+	}
+
+	serves := false
+	var carveOuts []netip.Prefix
+	for _, allocation := range pool.Status.Allocations {
+		addr, err := netip.ParseAddr(allocation.IP)
+		if err != nil {
+			continue
+		}
+
+		service := &corev1.Service{}
+		key := client.ObjectKey{Namespace: allocation.ServiceRef.Namespace, Name: allocation.ServiceRef.Name}
+		if err := r.Get(ctx, key, service); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return false, nil, err
+		}
+		if service.UID != allocation.ServiceRef.UID || !service.DeletionTimestamp.IsZero() || !r.isManagedLoadBalancer(service) {
+			continue
+		}
+
+		covered, err := r.allocationCovered(ctx, service, pool)
+		if err != nil {
+			return false, nil, err
+		}
+		if !covered {
+			carveOuts = append(carveOuts, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		serves = true
+	}
+	if !serves {
+		log.V(1).Info("No Service of this node is covered by the aggregated routes")
+		return false, nil, nil
+	}
+	return true, carveOuts, nil
+}
+
+// allocationCovered reports whether the address of the Service allocated from the pool is covered by the
+// aggregated routes of the pool. Services with invalid annotations are not, so that they are never announced
+// with a next hop or in a VNI they did not ask for.
+func (r *ServiceReconciler) allocationCovered(
+	ctx context.Context,
+	service *corev1.Service,
+	pool *metalloadbalancerv1alpha1.LoadBalancerIPPool,
+) (bool, error) {
+	vni, err := r.serviceVNI(ctx, service)
+	if errors.Is(err, errInvalidAnnotation) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	annotatedSpec, err := nextHopFromAnnotations(service)
+	if err != nil {
+		return false, nil
+	}
+	return r.coveredByAggregate(ctx, service, pool, vni, annotatedSpec)
+}
+
+// poolRoutes returns the routes of the CIDRs of the pool without its exclusions and the given carve-outs.
+func (r *ServiceReconciler) poolRoutes(
+	ctx context.Context,
+	pool *metalloadbalancerv1alpha1.LoadBalancerIPPool,
+	carveOuts []netip.Prefix,
+) (sets.Set[Route], error) {
+	nodeAddress, err := r.nodeAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cidrs, err := prefixutils.Parse(pool.Spec.CIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDRs of LoadBalancerIPPool %s: %w", pool.Name, err)
+	}
+	exclusions, err := prefixutils.Parse(pool.Spec.Exclusions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclusions of LoadBalancerIPPool %s: %w", pool.Name, err)
+	}
+	exclusions = append(exclusions, carveOuts...)
+
+	spec := metalloadbalancerv1alpha1.NextHop{Type: metalloadbalancerv1alpha1.NextHopTypeStandard}
+	if pool.Spec.NextHop != nil {
+		spec = *pool.Spec.NextHop
+	}
+	vni := metalbond.VNI(r.VNI)
+	nextHop := r.nextHop(nodeAddress, vni, spec)
+
+	routes := sets.New[Route]()
+	for _, cidr := range cidrs {
+		for _, prefix := range prefixutils.Subtract(cidr, exclusions) {
+			ipVersion := metalbond.IPV6
+			if prefix.Addr().Is4() {
+				ipVersion = metalbond.IPV4
+			}
+			dest := metalbond.Destination{IPVersion: ipVersion, Prefix: prefix}
+			routes.Insert(Route{VNI: vni, Dest: dest, NextHop: nextHop})
+		}
+	}
+	return routes, nil
+}
+
+// enqueueServicePools enqueues the LoadBalancerIPPools the addresses of the Service are allocated from.
+func (r *ServiceReconciler) enqueueServicePools(ctx context.Context, obj client.Object) []ctrl.Request {
+	log := ctrl.LoggerFrom(ctx)
+	poolList := &metalloadbalancerv1alpha1.LoadBalancerIPPoolList{}
+	if err := r.List(ctx, poolList); err != nil {
+		log.Error(err, "failed to list LoadBalancerIPPools")
+		return nil
+	}
+
+	var reqs []ctrl.Request
+	for _, pool := range poolList.Items {
+		if slices.ContainsFunc(pool.Status.Allocations, func(allocation metalloadbalancerv1alpha1.IPAllocation) bool {
+			return allocation.ServiceRef.UID == obj.GetUID()
+		}) {
+			reqs = append(reqs, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&pool)})
+		}
+	}
+	return reqs
+}
+
+// enqueuePools enqueues all LoadBalancerIPPools.
+func (r *ServiceReconciler) enqueuePools(ctx context.Context, _ client.Object) []ctrl.Request {
+	log := ctrl.LoggerFrom(ctx)
+	poolList := &metalloadbalancerv1alpha1.LoadBalancerIPPoolList{}
+	if err := r.List(ctx, poolList); err != nil {
+		log.Error(err, "failed to list LoadBalancerIPPools")
+		return nil
+	}
+
+	reqs := make([]ctrl.Request, 0, len(poolList.Items))
+	for _, pool := range poolList.Items {
+		reqs = append(reqs, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&pool)})
+	}
+	return reqs
+}
+
+func (r *ServiceReconciler) setupAggregationWithManager(mgr ctrl.Manager, events chan<- event.GenericEvent) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("loadbalancerippool-aggregation").
+		For(&metalloadbalancerv1alpha1.LoadBalancerIPPool{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// Aggregated routes have to be announced or withdrawn when the labels or the addresses of this node change.
+		Watches(
+			&corev1.Node{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueuePools),
+			builder.WithPredicates(r.nodeChangedPredicates()...),
+		).
+		// Aggregated routes are only announced while this node announces a Service covered by them.
+		Watches(
+			&corev1.Service{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueServicePools),
+		).
+		Watches(
+			&metalloadbalancerv1alpha1.VNIMapping{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueuePools),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueuePools),
+			builder.WithPredicates(predicate.LabelChangedPredicate{}),
+		).
+		Complete(reconcile.Func(func(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+			return r.reconcileAggregate(ctx, req, events)
+		}))
+}
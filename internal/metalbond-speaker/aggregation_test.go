@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"context"
+	"net/netip"
+
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	"github.com/ironcore-dev/metalbond"
+	"github.com/ironcore-dev/metalbond/pb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
+)
+
+var _ = Describe("Aggregation", func() {
+	ns := SetupTest()
+
+	nodeNextHop := metalbond.NextHop{TargetAddress: netip.MustParseAddr(nodeIP), TargetVNI: defaultVNI, Type: pb.NextHopType_STANDARD}
+
+	// createAggregatedServices creates an aggregated pool of 203.0.113.0/30 with a Service at 203.0.113.1 and
+	// another one at 203.0.113.2, which is created after applying the given mutations.
+	createAggregatedServices := func(ctx context.Context, mutate ...func(*corev1.Service)) (covered, other *corev1.Service) {
+		pool := createPool(ctx, "203.0.113.0/30")
+		pool.Spec.Aggregate = true
+		Expect(k8sClient.Update(ctx, pool)).To(Succeed())
+
+		covered = createLoadBalancerService(ctx, ns.Name, nil)
+		other = createLoadBalancerService(ctx, ns.Name, nil, mutate...)
+		Eventually(UpdateStatus(pool, func() {
+			pool.Status.Allocations = nil
+			for ip, service := range map[string]*corev1.Service{"203.0.113.1": covered, "203.0.113.2": other} {
+				pool.Status.Allocations = append(pool.Status.Allocations, metalloadbalancerv1alpha1.IPAllocation{
+					IP: ip,
+					ServiceRef: metalloadbalancerv1alpha1.ServiceReference{
+						Namespace: service.Namespace,
+						Name:      service.Name,
+						UID:       service.UID,
+					},
+				})
+			}
+		})).Should(Succeed())
+		setIngress(covered, "203.0.113.1")
+		setIngress(other, "203.0.113.2")
+		return covered, other
+	}
+
+	It("should announce the CIDRs of the pool instead of the addresses of its Services", func(ctx SpecContext) {
+		createAggregatedServices(ctx)
+
+		Eventually(serverRoutes.Routes).Should(ContainElement(prefixRoute(defaultVNI, "203.0.113.0/30", nodeNextHop)))
+		Consistently(serverRoutes.Routes).ShouldNot(ContainElements(
+			hostRoute(defaultVNI, "203.0.113.1", nodeNextHop),
+			hostRoute(defaultVNI, "203.0.113.2", nodeNextHop),
+		))
+	})
+
+	It("should carve the addresses of Services in other VNIs out of the aggregated routes", func(ctx SpecContext) {
+		_, other := createAggregatedServices(ctx)
+		Eventually(serverRoutes.Routes).Should(ContainElement(prefixRoute(defaultVNI, "203.0.113.0/30", nodeNextHop)))
+
+		By("moving a Service to another VNI")
+		Eventually(Update(other, func() {
+			other.Annotations = map[string]string{metalloadbalancerv1alpha1.ServiceVNIAnnotation: "200"}
+		})).Should(Succeed())
+
+		tenantNextHop := nodeNextHop
+		tenantNextHop.TargetVNI = 200
+		Eventually(serverRoutes.Routes).Should(SatisfyAll(
+			ContainElements(
+				prefixRoute(defaultVNI, "203.0.113.0/31", nodeNextHop),
+				prefixRoute(defaultVNI, "203.0.113.3/32", nodeNextHop),
+				hostRoute(200, "203.0.113.2", tenantNextHop),
+			),
+			Not(ContainElement(prefixRoute(defaultVNI, "203.0.113.0/30", nodeNextHop))),
+		))
+	})
+
+	It("should carve the addresses of Services the node does not serve out of the aggregated routes", func(ctx SpecContext) {
+		createAggregatedServices(ctx, func(service *corev1.Service) {
+			service.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyLocal
+		})
+
+		Eventually(serverRoutes.Routes).Should(ContainElements(
+			prefixRoute(defaultVNI, "203.0.113.0/31", nodeNextHop),
+			prefixRoute(defaultVNI, "203.0.113.3/32", nodeNextHop),
+		))
+		Consistently(serverRoutes.Routes).ShouldNot(ContainElement(SatisfyAny(
+			Equal(prefixRoute(defaultVNI, "203.0.113.0/30", nodeNextHop)),
+			Equal(hostRoute(defaultVNI, "203.0.113.2", nodeNextHop)),
+		)))
+	})
+})
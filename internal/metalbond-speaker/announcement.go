@@ -0,0 +1,333 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	"github.com/ironcore-dev/metal-load-balancer-controller/internal/serviceutils"
+	"github.com/ironcore-dev/metalbond/pb"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// ServiceAnnouncementName returns the name of the ServiceAnnouncement of the given Service and node. Service
+// names cannot contain dots, so the first dot separates the name of the Service from the name of the node. If
+// the name gets too long, the name of the node is replaced by its hash.
+func ServiceAnnouncementName(serviceName, nodeName string) string {
+	name := serviceName + "." + nodeName
+	if len(name) > validation.DNS1123SubdomainMaxLength {
+		sum := sha256.Sum256([]byte(nodeName))
+		name = serviceName + "." + hex.EncodeToString(sum[:16])
+	}
+	return name
+}
+
+// getAnnouncement returns the ServiceAnnouncement of the Service and this node, or nil if there is none. An
+// object of that name reporting another Service or node is an error.
+func (r *ServiceReconciler) getAnnouncement(ctx context.Context, service *corev1.Service) (*metalloadbalancerv1alpha1.ServiceAnnouncement, error) {
+	announcement := &metalloadbalancerv1alpha1.ServiceAnnouncement{}
+	key := client.ObjectKey{Namespace: service.Namespace, Name: ServiceAnnouncementName(service.Name, r.NodeName)}
+	if err := r.Get(ctx, key, announcement); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get ServiceAnnouncement: %w", err)
+	}
+	if !metav1.IsControlledBy(announcement, service) {
+		return nil, fmt.Errorf("ServiceAnnouncement %s is not controlled by Service %s", key.Name, service.Name)
+	}
+	if announcement.Spec.ServiceRef.Name != service.Name || announcement.Spec.NodeName != r.NodeName {
+		return nil, fmt.Errorf("ServiceAnnouncement %s reports Service %s on node %s instead of Service %s on node %s",
+			key.Name, announcement.Spec.ServiceRef.Name, announcement.Spec.NodeName, service.Name, r.NodeName)
+	}
+	return announcement, nil
+}
+
+// updateAnnouncement reports the routes announced for the Service in its ServiceAnnouncement. The
+// ServiceAnnouncement is deleted if no routes are announced.
+func (r *ServiceReconciler) updateAnnouncement(ctx context.Context, log logr.Logger, service *corev1.Service, routes sets.Set[Route]) error {
+	if routes.Len() == 0 {
+		return r.deleteAnnouncement(ctx, log, service)
+	}
+
+	announcement, err := r.getAnnouncement(ctx, service)
+	if err != nil {
+		return err
+	}
+	if announcement == nil {
+		announcement = &metalloadbalancerv1alpha1.ServiceAnnouncement{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: service.Namespace,
+				Name:      ServiceAnnouncementName(service.Name, r.NodeName),
+			},
+			Spec: metalloadbalancerv1alpha1.ServiceAnnouncementSpec{
+				ServiceRef: corev1.LocalObjectReference{Name: service.Name},
+				NodeName:   r.NodeName,
+			},
+		}
+		if err := controllerutil.SetControllerReference(service, announcement, r.Scheme); err != nil {
+			return fmt.Errorf("failed to set owner reference of ServiceAnnouncement: %w", err)
+		}
+		if err := r.Create(ctx, announcement); err != nil {
+			return fmt.Errorf("failed to create ServiceAnnouncement: %w", err)
+		}
+		log.V(1).Info("Created ServiceAnnouncement", "ServiceAnnouncement", announcement.Name)
+	}
+
+	status := metalloadbalancerv1alpha1.ServiceAnnouncementStatus{
+		Routes:            announcedRoutes(routes),
+		Peers:             r.peerStatuses(),
+		LastAnnouncedTime: announcement.Status.LastAnnouncedTime,
+	}
+	if status.LastAnnouncedTime == nil || !equality.Semantic.DeepEqual(status.Routes, announcement.Status.Routes) {
+		now := metav1.Now()
+		status.LastAnnouncedTime = &now
+		r.Recorder.Eventf(service, nil, corev1.EventTypeNormal, "Announced", "Announce",
+			"Node %s announces %d routes", r.NodeName, len(status.Routes))
+	}
+	if equality.Semantic.DeepEqual(status, announcement.Status) {
+		return nil
+	}
+
+	base := announcement.DeepCopy()
+	announcement.Status = status
+	if err := r.Status().Patch(ctx, announcement, client.MergeFrom(base)); err != nil {
+		return fmt.Errorf("failed to patch ServiceAnnouncement status: %w", err)
+	}
+	log.V(1).Info("Updated ServiceAnnouncement", "ServiceAnnouncement", announcement.Name)
+	return nil
+}
+
+// deleteAnnouncement deletes the ServiceAnnouncement of the Service, if any.
+func (r *ServiceReconciler) deleteAnnouncement(ctx context.Context, log logr.Logger, service *corev1.Service) error {
+	announcement, err := r.getAnnouncement(ctx, service)
+	if err != nil || announcement == nil {
+		return err
+	}
+	if err := r.Delete(ctx, announcement, client.Preconditions{UID: &announcement.UID}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete ServiceAnnouncement: %w", err)
+	}
+	log.V(1).Info("Deleted ServiceAnnouncement", "ServiceAnnouncement", announcement.Name)
+	r.Recorder.Eventf(service, nil, corev1.EventTypeNormal, "Withdrawn", "Withdraw", "Node %s withdrew its routes", r.NodeName)
+	return nil
+}
+
+// updateAnnouncementPeers reports the current state of the metalbond sessions in the ServiceAnnouncement of the
+// Service, if any. It keeps the state up to date while no session is established and the Service is not
+// reconciled any further.
+func (r *ServiceReconciler) updateAnnouncementPeers(ctx context.Context, log logr.Logger, service *corev1.Service) error {
+	announcement, err := r.getAnnouncement(ctx, service)
+	if err != nil || announcement == nil {
+		return err
+	}
+	peers := r.peerStatuses()
+	if equality.Semantic.DeepEqual(peers, announcement.Status.Peers) {
+		return nil
+	}
+
+	base := announcement.DeepCopy()
+	announcement.Status.Peers = peers
+	if err := r.Status().Patch(ctx, announcement, client.MergeFrom(base)); err != nil {
+		return fmt.Errorf("failed to patch ServiceAnnouncement status: %w", err)
+	}
+	log.V(1).Info("Updated peers of ServiceAnnouncement", "ServiceAnnouncement", announcement.Name)
+	return nil
+}
+
+// deleteStaleAnnouncements deletes the ServiceAnnouncements of nodes that no longer exist. Their speakers will
+// never update or delete them.
+func (r *ServiceReconciler) deleteStaleAnnouncements(ctx context.Context, log logr.Logger) error {
+	nodeList := &corev1.NodeList{}
+	if err := r.List(ctx, nodeList); err != nil {
+		return fmt.Errorf("failed to list Nodes: %w", err)
+	}
+	nodeNames := sets.New[string]()
+	for _, node := range nodeList.Items {
+		nodeNames.Insert(node.Name)
+	}
+
+	announcementList := &metalloadbalancerv1alpha1.ServiceAnnouncementList{}
+	if err := r.List(ctx, announcementList); err != nil {
+		return fmt.Errorf("failed to list ServiceAnnouncements: %w", err)
+	}
+	var errs []error
+	for _, announcement := range announcementList.Items {
+		if nodeNames.Has(announcement.Spec.NodeName) {
+			continue
+		}
+		if err := r.Delete(ctx, &announcement, client.Preconditions{UID: &announcement.UID}); client.IgnoreNotFound(err) != nil {
+			errs = append(errs, fmt.Errorf("failed to delete ServiceAnnouncement %s/%s: %w", announcement.Namespace, announcement.Name, err))
+			continue
+		}
+		log.Info("Deleted ServiceAnnouncement of deleted node", "ServiceAnnouncement", client.ObjectKeyFromObject(&announcement), "Node", announcement.Spec.NodeName)
+	}
+	return errors.Join(errs...)
+}
+
+// patchAnnouncedConditions reports whether any node announces the Service and clears a previous announcement
+// failure of this node. The conditions are shared by the speakers of all nodes, so failures of other nodes are
+// left untouched.
+//
+// Until the Service is announced for the first time, the Announced condition has the reason Pending. The
+// optimistic lock of the patch lets exactly one speaker flip it to True, which observes the latency of the
+// first announcement. A Service without the condition is only observed if it was created after the speaker
+// started, since it may have been announced long ago by a speaker not reporting the condition yet.
+func (r *ServiceReconciler) patchAnnouncedConditions(ctx context.Context, service *corev1.Service, announced bool) error {
+	if !announced {
+		var err error
+		if announced, err = r.announcedByOtherNode(ctx, service); err != nil {
+			return err
+		}
+	}
+
+	previous := meta.FindStatusCondition(service.Status.Conditions, metalloadbalancerv1alpha1.ServiceAnnouncedCondition)
+	pending := previous == nil || previous.Reason == "Pending"
+	condition := metav1.Condition{
+		Type:    metalloadbalancerv1alpha1.ServiceAnnouncedCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  "NotAnnounced",
+		Message: "No node announces the Service",
+	}
+	switch {
+	case announced:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Announced"
+		condition.Message = "The Service is announced by at least one node"
+	case pending:
+		condition.Reason = "Pending"
+		condition.Message = "No node has announced the Service yet"
+	}
+	modified, err := serviceutils.PatchServiceCondition(ctx, r.Client, service, condition)
+	if err != nil {
+		return err
+	}
+	// The creation timestamp only has a precision of seconds.
+	firstAnnouncement := previous != nil || !service.CreationTimestamp.Time.Before(r.startTime.Truncate(time.Second))
+	if modified && announced && pending && firstAnnouncement {
+		firstAnnouncementLatency.Observe(time.Since(service.CreationTimestamp.Time).Seconds())
+	}
+
+	failed := meta.FindStatusCondition(service.Status.Conditions, metalloadbalancerv1alpha1.ServiceAnnouncementFailedCondition)
+	if failed != nil && (failed.Status != metav1.ConditionTrue || !strings.HasPrefix(failed.Message, r.failureMessagePrefix())) {
+		return nil
+	}
+	_, err = serviceutils.PatchServiceCondition(ctx, r.Client, service, metav1.Condition{
+		Type:    metalloadbalancerv1alpha1.ServiceAnnouncementFailedCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  "NoFailure",
+		Message: "No node failed to announce the Service",
+	})
+	return err
+}
+
+// patchAnnouncementFailedCondition reports that this node failed to announce the Service.
+func (r *ServiceReconciler) patchAnnouncementFailedCondition(ctx context.Context, service *corev1.Service, reason string, err error) error {
+	_, patchErr := serviceutils.PatchServiceCondition(ctx, r.Client, service, metav1.Condition{
+		Type:    metalloadbalancerv1alpha1.ServiceAnnouncementFailedCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: r.failureMessagePrefix() + " " + err.Error(),
+	})
+	return patchErr
+}
+
+func (r *ServiceReconciler) failureMessagePrefix() string {
+	return fmt.Sprintf("Node %s:", r.NodeName)
+}
+
+// announcedByOtherNode reports whether the ServiceAnnouncement of another existing node lists routes of the
+// Service. ServiceAnnouncements of deleted nodes are left until they are garbage collected.
+func (r *ServiceReconciler) announcedByOtherNode(ctx context.Context, service *corev1.Service) (bool, error) {
+	announcementList := &metalloadbalancerv1alpha1.ServiceAnnouncementList{}
+	if err := r.List(ctx, announcementList, client.InNamespace(service.Namespace)); err != nil {
+		return false, fmt.Errorf("failed to list ServiceAnnouncements: %w", err)
+	}
+	for _, announcement := range announcementList.Items {
+		if announcement.Spec.ServiceRef.Name != service.Name || announcement.Spec.NodeName == r.NodeName ||
+			len(announcement.Status.Routes) == 0 {
+			continue
+		}
+		if err := r.Get(ctx, client.ObjectKey{Name: announcement.Spec.NodeName}, &corev1.Node{}); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return false, fmt.Errorf("failed to get Node %s: %w", announcement.Spec.NodeName, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// announcedRoutes converts the given routes to their API representation, sorted by prefix.
+func announcedRoutes(routes sets.Set[Route]) []metalloadbalancerv1alpha1.AnnouncedRoute {
+	res := make([]metalloadbalancerv1alpha1.AnnouncedRoute, 0, routes.Len())
+	for _, route := range routes.UnsortedList() {
+		announced := metalloadbalancerv1alpha1.AnnouncedRoute{
+			VNI:         int32(route.VNI),
+			Prefix:      route.Dest.String(),
+			NextHop:     route.NextHop.TargetAddress.String(),
+			NextHopType: nextHopType(route.NextHop.Type),
+		}
+		if route.NextHop.Type == pb.NextHopType_NAT {
+			announced.NATPortRange = &metalloadbalancerv1alpha1.PortRange{
+				From: int32(route.NextHop.NATPortRangeFrom),
+				To:   int32(route.NextHop.NATPortRangeTo),
+			}
+		}
+		res = append(res, announced)
+	}
+	slices.SortFunc(res, func(a, b metalloadbalancerv1alpha1.AnnouncedRoute) int {
+		return cmp.Or(
+			cmp.Compare(a.Prefix, b.Prefix),
+			cmp.Compare(a.VNI, b.VNI),
+			cmp.Compare(a.NextHop, b.NextHop),
+		)
+	})
+	return res
+}
+
+func nextHopType(typ pb.NextHopType) metalloadbalancerv1alpha1.NextHopType {
+	switch typ {
+	case pb.NextHopType_NAT:
+		return metalloadbalancerv1alpha1.NextHopTypeNAT
+	case pb.NextHopType_LOADBALANCER_TARGET:
+		return metalloadbalancerv1alpha1.NextHopTypeLoadBalancerTarget
+	default:
+		return metalloadbalancerv1alpha1.NextHopTypeStandard
+	}
+}
+
+// peerStatuses returns the current state of the sessions with all peers.
+func (r *ServiceReconciler) peerStatuses() []metalloadbalancerv1alpha1.PeerStatus {
+	statuses := make([]metalloadbalancerv1alpha1.PeerStatus, 0, len(r.Peers))
+	for _, peer := range r.Peers {
+		state := "Unknown"
+		if s, err := peer.MetalBond.PeerState(peer.Server); err == nil {
+			state = s.String()
+		}
+		statuses = append(statuses, metalloadbalancerv1alpha1.PeerStatus{Server: peer.Server, State: state})
+	}
+	return statuses
+}
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"context"
+	"strings"
+
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
+)
+
+var _ = Describe("ServiceAnnouncementName", func() {
+	It("should join the Service and node name", func() {
+		Expect(ServiceAnnouncementName("foo", "node-1.example.org")).To(Equal("foo.node-1.example.org"))
+		Expect(ServiceAnnouncementName("a-b", "c")).NotTo(Equal(ServiceAnnouncementName("a", "b-c")))
+	})
+
+	It("should shorten names exceeding the maximum length of an object name", func() {
+		longNode := strings.Repeat("n", validation.DNS1123SubdomainMaxLength)
+		name := ServiceAnnouncementName("foo", longNode)
+		Expect(validation.IsDNS1123Subdomain(name)).To(BeEmpty())
+		Expect(name).To(HavePrefix("foo."))
+		Expect(name).NotTo(Equal(ServiceAnnouncementName("foo", longNode+"x")))
+	})
+})
+
+var _ = Describe("ServiceAnnouncement", func() {
+	ns := SetupTest()
+
+	It("should report the routes announced by the node for the Service", func(ctx SpecContext) {
+		service := createLoadBalancerService(ctx, ns.Name, []string{"192.0.2.15"})
+		announcement := &metalloadbalancerv1alpha1.ServiceAnnouncement{ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns.Name,
+			Name:      ServiceAnnouncementName(service.Name, nodeName),
+		}}
+
+		By("creating the ServiceAnnouncement owned by the Service")
+		Eventually(Object(announcement)).Should(SatisfyAll(
+			HaveField("OwnerReferences", ConsistOf(SatisfyAll(
+				HaveField("UID", service.UID),
+				HaveField("Controller", HaveValue(BeTrue())),
+			))),
+			HaveField("Spec.ServiceRef.Name", service.Name),
+			HaveField("Spec.NodeName", nodeName),
+			HaveField("Status.Routes", ConsistOf(metalloadbalancerv1alpha1.AnnouncedRoute{
+				VNI:         defaultVNI,
+				Prefix:      "192.0.2.15/32",
+				NextHop:     nodeIP,
+				NextHopType: metalloadbalancerv1alpha1.NextHopTypeStandard,
+			})),
+			HaveField("Status.Peers", ConsistOf(metalloadbalancerv1alpha1.PeerStatus{Server: serverAddr, State: "ESTABLISHED"})),
+			HaveField("Status.LastAnnouncedTime", Not(BeNil())),
+		))
+
+		By("changing the ingress IP")
+		setIngress(service, "192.0.2.16")
+		Eventually(Object(announcement)).Should(HaveField("Status.Routes", ConsistOf(
+			HaveField("Prefix", "192.0.2.16/32"),
+		)))
+
+		By("deleting the Service")
+		Expect(k8sClient.Delete(ctx, service)).To(Succeed())
+		Eventually(Get(announcement)).Should(Satisfy(apierrors.IsNotFound))
+	})
+
+	It("should delete the ServiceAnnouncements of nodes that no longer exist", func(ctx SpecContext) {
+		service := createLoadBalancerService(ctx, ns.Name, nil)
+		stale := &metalloadbalancerv1alpha1.ServiceAnnouncement{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      ServiceAnnouncementName(service.Name, "gone-node"),
+			},
+			Spec: metalloadbalancerv1alpha1.ServiceAnnouncementSpec{
+				ServiceRef: corev1.LocalObjectReference{Name: service.Name},
+				NodeName:   "gone-node",
+			},
+		}
+		Expect(k8sClient.Create(ctx, stale)).To(Succeed())
+		DeferCleanup(func(ctx context.Context) error {
+			return client.IgnoreNotFound(k8sClient.Delete(ctx, stale))
+		})
+
+		Eventually(Get(stale)).Should(Satisfy(apierrors.IsNotFound))
+	})
+})
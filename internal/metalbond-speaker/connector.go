@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ironcore-dev/metalbond"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// DefaultConnectBackoff is the backoff used while waiting for the metalbond session to be established.
+var DefaultConnectBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    math.MaxInt32,
+	Cap:      30 * time.Second,
+}
+
+// Connector connects the speaker to a metalbond server and subscribes to the VNI in the background, so that
+// the manager keeps running while the server is unavailable.
+type Connector struct {
+	Peer    Peer
+	VNI     int
+	Backoff wait.Backoff
+}
+
+func (c *Connector) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("metalbond-connector").WithValues("Server", c.Peer.Server)
+
+	// The peer keeps reconnecting on its own once it has been added.
+	log.Info("Adding metalbond peer")
+	if err := c.Peer.MetalBond.AddPeer(c.Peer.Server, ""); err != nil {
+		return fmt.Errorf("failed to add metalbond peer %s: %w", c.Peer.Server, err)
+	}
+
+	if err := wait.ExponentialBackoffWithContext(ctx, c.Backoff, func(context.Context) (bool, error) {
+		if err := c.Peer.CheckEstablished(); err != nil {
+			log.Info("Waiting for metalbond session to be established", "Reason", err.Error())
+			return false, nil
+		}
+		return true, nil
+	}); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to establish metalbond session with %s: %w", c.Peer.Server, err)
+	}
+	log.Info("Metalbond session established")
+
+	// Subscriptions are recorded even if they cannot be sent and are renewed whenever the session is established.
+	if !c.Peer.MetalBond.IsSubscribed(metalbond.VNI(c.VNI)) {
+		if err := c.Peer.MetalBond.Subscribe(metalbond.VNI(c.VNI)); err != nil {
+			log.Error(err, "Failed to send subscription, retrying once the session is re-established", "VNI", c.VNI)
+		}
+	}
+	log.Info("Subscribed to VNI", "VNI", c.VNI)
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every speaker needs its own session.
+func (c *Connector) NeedLeaderElection() bool {
+	return false
+}
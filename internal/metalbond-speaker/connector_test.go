@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"context"
+	"math"
+	"net"
+	"time"
+
+	"github.com/ironcore-dev/metalbond"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Connector", func() {
+	ns := SetupTest()
+
+	// freeAddr returns a local address no metalbond server listens on yet.
+	freeAddr := func() string {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { Expect(listener.Close()).To(Succeed()) }()
+		return listener.Addr().String()
+	}
+
+	// startConnector runs a Connector for a new peer of the given server until the end of the spec.
+	startConnector := func(addr string) (Peer, <-chan error, context.CancelFunc) {
+		peer := NewPeers([]string{addr}, metalbond.Config{KeepaliveInterval: 1})[0]
+		DeferCleanup(peer.MetalBond.Shutdown)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		connector := &Connector{
+			Peer:    peer,
+			VNI:     defaultVNI,
+			Backoff: wait.Backoff{Duration: 100 * time.Millisecond, Factor: 1, Steps: math.MaxInt32},
+		}
+		done := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			done <- connector.Start(ctx)
+		}()
+		return peer, done, cancel
+	}
+
+	It("should keep retrying until the server is available and subscribe to the VNI", func() {
+		addr := freeAddr()
+		peer, done, _ := startConnector(addr)
+		Consistently(done).ShouldNot(Receive())
+		Expect(peer.MetalBond.IsSubscribed(defaultVNI)).To(BeFalse())
+
+		By("starting the metalbond server")
+		DeferCleanup(startMetalBondServer(addr, &routeRecorder{}))
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(peer.CheckEstablished()).To(Succeed())
+		Expect(peer.MetalBond.IsSubscribed(defaultVNI)).To(BeTrue())
+	})
+
+	It("should stop without an error when the manager stops", func() {
+		_, done, cancel := startConnector(freeAddr())
+		Consistently(done).ShouldNot(Receive())
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("should requeue Services while no session is established", func(ctx SpecContext) {
+		addr := freeAddr()
+		peer, _, _ := startConnector(addr)
+		r := &ServiceReconciler{
+			Client:   k8sClient,
+			Scheme:   k8sClient.Scheme(),
+			VNI:      defaultVNI,
+			Peers:    []Peer{peer},
+			NodeName: "disconnected-node",
+			Routes:   NewAnnouncedRoutes(),
+		}
+		service := createLoadBalancerService(ctx, ns.Name, []string{"192.0.2.6"})
+
+		Expect(r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(service)})).
+			To(Equal(ctrl.Result{RequeueAfter: sessionRequeueInterval}))
+		Expect(r.Routes.Keys()).To(BeEmpty())
+	})
+})
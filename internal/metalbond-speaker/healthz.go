@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ironcore-dev/metalbond"
+)
+
+// SessionChecker reports the health of the metalbond sessions of the speaker.
+type SessionChecker struct {
+	peers       []Peer
+	vni         int
+	gracePeriod time.Duration
+
+	mu              sync.Mutex
+	lastEstablished time.Time
+}
+
+// NewSessionChecker returns a SessionChecker for the sessions with the given peers, which have to be subscribed
+// to the given VNI. A session is considered to have been established at creation time, so the grace period also
+// applies to the initial connect.
+func NewSessionChecker(peers []Peer, vni int, gracePeriod time.Duration) *SessionChecker {
+	return &SessionChecker{
+		peers:           peers,
+		vni:             vni,
+		gracePeriod:     gracePeriod,
+		lastEstablished: time.Now(),
+	}
+}
+
+// Readyz fails if no session is established and subscribed to the VNI, reporting the state of every peer.
+// metalbond does not acknowledge subscriptions, but re-sends them whenever a session is established, so an
+// established session is subscribed to every VNI subscribed locally.
+func (c *SessionChecker) Readyz(_ *http.Request) error {
+	var errs []error
+	for _, peer := range c.peers {
+		if err := peer.CheckEstablished(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !peer.MetalBond.IsSubscribed(metalbond.VNI(c.vni)) {
+			errs = append(errs, fmt.Errorf("metalbond peer %s is not subscribed to VNI %d", peer.Server, c.vni))
+			continue
+		}
+		return nil
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("no metalbond peers configured")
+	}
+	return errors.Join(errs...)
+}
+
+// Livez fails if no session has been established for longer than the grace period.
+func (c *SessionChecker) Livez(_ *http.Request) error {
+	err := anyPeerEstablished(c.peers)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		c.lastEstablished = time.Now()
+		return nil
+	}
+	if down := time.Since(c.lastEstablished); down > c.gracePeriod {
+		return fmt.Errorf("metalbond sessions have been down for %s: %w", down.Round(time.Second), err)
+	}
+	return nil
+}
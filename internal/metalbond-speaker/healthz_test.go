@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"time"
+
+	"github.com/ironcore-dev/metalbond"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SessionChecker", func() {
+	It("should be ready while a session is established and subscribed to the VNI", func() {
+		Expect(NewSessionChecker(peers, defaultVNI, time.Minute).Readyz(nil)).To(Succeed())
+	})
+
+	It("should not be ready while no session is subscribed to the VNI", func() {
+		checker := NewSessionChecker(peers, defaultVNI+1, time.Minute)
+		Expect(checker.Readyz(nil)).To(MatchError(ContainSubstring("not subscribed to VNI")))
+	})
+
+	It("should not be ready while no session is established", func() {
+		unreachable := NewPeers([]string{"[::1]:1"}, metalbond.Config{})
+		checker := NewSessionChecker(unreachable, defaultVNI, 0)
+		Expect(checker.Readyz(nil)).To(HaveOccurred())
+
+		By("failing the liveness probe once the grace period passed")
+		Eventually(func() error { return checker.Livez(nil) }).WithPolling(10 * time.Millisecond).Should(HaveOccurred())
+	})
+})
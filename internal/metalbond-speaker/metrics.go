@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"strconv"
+
+	"github.com/ironcore-dev/metalbond"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	routeOperationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "metalbond_speaker_route_operation_duration_seconds",
+			Help:    "Duration of announcing and withdrawing routes at a metalbond server.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		},
+		[]string{"operation", "server"},
+	)
+	routeOperationErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "metalbond_speaker_route_operation_errors_total",
+			Help: "Number of failed announcements and withdrawals of routes at a metalbond server.",
+		},
+		[]string{"operation", "server"},
+	)
+	firstAnnouncementLatency = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "metalbond_speaker_service_first_announcement_seconds",
+			Help:    "Time from the creation of a Service to its first announcement.",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+		},
+	)
+
+	announcedRoutesDesc = prometheus.NewDesc(
+		"metalbond_speaker_announced_routes",
+		"Number of routes announced by the speaker.",
+		[]string{"vni"}, nil,
+	)
+	peerStateDesc = prometheus.NewDesc(
+		"metalbond_speaker_peer_state",
+		"State of the metalbond session with a server. The gauge of the current state is 1, all others are 0.",
+		[]string{"server", "state"}, nil,
+	)
+)
+
+const (
+	operationAnnounce = "announce"
+	operationWithdraw = "withdraw"
+)
+
+// peerStates are the states a metalbond session may be in.
+var peerStates = []metalbond.ConnectionState{
+	metalbond.CONNECTING,
+	metalbond.HELLO_SENT,
+	metalbond.HELLO_RECEIVED,
+	metalbond.ESTABLISHED,
+	metalbond.RETRY,
+	metalbond.CLOSED,
+}
+
+func init() {
+	metrics.Registry.MustRegister(routeOperationDuration, routeOperationErrors, firstAnnouncementLatency)
+}
+
+// speakerCollector reports the announced routes and the state of the metalbond sessions on every scrape.
+type speakerCollector struct {
+	routes *AnnouncedRoutes
+	peers  []Peer
+}
+
+func (c *speakerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- announcedRoutesDesc
+	ch <- peerStateDesc
+}
+
+func (c *speakerCollector) Collect(ch chan<- prometheus.Metric) {
+	// Routes shared by several Services are announced once, so they are counted once.
+	perVNI := make(map[metalbond.VNI]int)
+	for route := range c.routes.All() {
+		perVNI[route.VNI]++
+	}
+	for vni, count := range perVNI {
+		ch <- prometheus.MustNewConstMetric(announcedRoutesDesc, prometheus.GaugeValue, float64(count), strconv.FormatUint(uint64(vni), 10))
+	}
+
+	for _, peer := range c.peers {
+		current, err := peer.MetalBond.PeerState(peer.Server)
+		for _, state := range peerStates {
+			value := 0.0
+			if err == nil && state == current {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(peerStateDesc, prometheus.GaugeValue, value, peer.Server, state.String())
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"strings"
+	"time"
+
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
+)
+
+var _ = Describe("Metrics", func() {
+	It("should count routes shared by several Services once", func() {
+		routes := NewAnnouncedRoutes()
+		shared := standardRoute(100, "192.0.2.1")
+		routes.Set(types.NamespacedName{Namespace: "default", Name: "foo"}, sets.New(shared, standardRoute(100, "192.0.2.2")))
+		routes.Set(types.NamespacedName{Namespace: "default", Name: "bar"}, sets.New(shared, standardRoute(200, "192.0.2.1")))
+
+		Expect(testutil.CollectAndCompare(&speakerCollector{routes: routes}, strings.NewReader(`
+# HELP metalbond_speaker_announced_routes Number of routes announced by the speaker.
+# TYPE metalbond_speaker_announced_routes gauge
+metalbond_speaker_announced_routes{vni="100"} 2
+metalbond_speaker_announced_routes{vni="200"} 1
+`), "metalbond_speaker_announced_routes")).To(Succeed())
+	})
+
+	Context("firstAnnouncementLatency", func() {
+		ns := SetupTest()
+
+		observations := func() uint64 {
+			metric := &dto.Metric{}
+			Expect(firstAnnouncementLatency.Write(metric)).To(Succeed())
+			return metric.GetHistogram().GetSampleCount()
+		}
+
+		// The Services are not LoadBalancers, so the speaker of the suite leaves their conditions alone.
+		createService := func(ctx SpecContext, conditions ...metav1.Condition) *corev1.Service {
+			service := createLoadBalancerService(ctx, ns.Name, nil, func(service *corev1.Service) {
+				service.Spec.Type = corev1.ServiceTypeClusterIP
+			})
+			if len(conditions) > 0 {
+				Eventually(UpdateStatus(service, func() {
+					service.Status.Conditions = conditions
+				})).Should(Succeed())
+			}
+			return service
+		}
+
+		It("should not observe Services created before the speaker started", func(ctx SpecContext) {
+			service := createService(ctx)
+			r := &ServiceReconciler{Client: k8sClient, NodeName: nodeName, startTime: time.Now().Add(time.Hour)}
+
+			before := observations()
+			Expect(r.patchAnnouncedConditions(ctx, service, true)).To(Succeed())
+			Expect(service.Status.Conditions).To(ContainElement(SatisfyAll(
+				HaveField("Type", metalloadbalancerv1alpha1.ServiceAnnouncedCondition),
+				HaveField("Reason", "Announced"),
+			)))
+			Expect(observations()).To(Equal(before))
+		})
+
+		It("should observe Services the condition of which is explicitly pending", func(ctx SpecContext) {
+			service := createService(ctx, metav1.Condition{
+				Type:               metalloadbalancerv1alpha1.ServiceAnnouncedCondition,
+				Status:             metav1.ConditionFalse,
+				Reason:             "Pending",
+				Message:            "No node has announced the Service yet",
+				LastTransitionTime: metav1.Now(),
+			})
+			r := &ServiceReconciler{Client: k8sClient, NodeName: nodeName, startTime: time.Now().Add(time.Hour)}
+
+			before := observations()
+			Expect(r.patchAnnouncedConditions(ctx, service, true)).To(Succeed())
+			Expect(observations()).To(Equal(before + 1))
+
+			By("not observing the Service again")
+			Expect(r.patchAnnouncedConditions(ctx, service, true)).To(Succeed())
+			Expect(observations()).To(Equal(before + 1))
+		})
+
+		It("should observe Services created after the speaker started", func(ctx SpecContext) {
+			r := &ServiceReconciler{Client: k8sClient, NodeName: nodeName, startTime: time.Now()}
+			service := createService(ctx)
+
+			before := observations()
+			Expect(r.patchAnnouncedConditions(ctx, service, true)).To(Succeed())
+			Expect(observations()).To(Equal(before + 1))
+		})
+	})
+})
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	"github.com/ironcore-dev/metalbond"
+	"github.com/ironcore-dev/metalbond/pb"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// servicePools returns the LoadBalancerIPPools the addresses of the Service are allocated from.
+func (r *ServiceReconciler) servicePools(ctx context.Context, service *corev1.Service) (map[netip.Addr]*metalloadbalancerv1alpha1.LoadBalancerIPPool, error) {
+	poolList := &metalloadbalancerv1alpha1.LoadBalancerIPPoolList{}
+	if err := r.List(ctx, poolList); err != nil {
+		return nil, fmt.Errorf("failed to list LoadBalancerIPPools: %w", err)
+	}
+
+	pools := make(map[netip.Addr]*metalloadbalancerv1alpha1.LoadBalancerIPPool)
+	for i := range poolList.Items {
+		pool := &poolList.Items[i]
+		for _, allocation := range pool.Status.Allocations {
+			if addr, err := netip.ParseAddr(allocation.IP); err == nil && allocation.ServiceRef.UID == service.UID {
+				pools[addr] = pool
+			}
+		}
+	}
+	return pools, nil
+}
+
+// errInvalidAnnotation is returned for Services with invalid annotations.
+var errInvalidAnnotation = errors.New("invalid annotation")
+
+// nextHopFromAnnotations returns the next hop set by the annotations of the Service, or nil if there is none.
+// The annotations take precedence over the next hop of the LoadBalancerIPPool.
+func nextHopFromAnnotations(service *corev1.Service) (*metalloadbalancerv1alpha1.NextHop, error) {
+	value, ok := service.Annotations[metalloadbalancerv1alpha1.ServiceNextHopTypeAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	spec := &metalloadbalancerv1alpha1.NextHop{Type: metalloadbalancerv1alpha1.NextHopType(value)}
+	switch spec.Type {
+	case metalloadbalancerv1alpha1.NextHopTypeStandard, metalloadbalancerv1alpha1.NextHopTypeLoadBalancerTarget:
+	case metalloadbalancerv1alpha1.NextHopTypeNAT:
+		portRange, err := parsePortRange(service.Annotations[metalloadbalancerv1alpha1.ServiceNATPortRangeAnnotation])
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: %w", errInvalidAnnotation, metalloadbalancerv1alpha1.ServiceNATPortRangeAnnotation, err)
+		}
+		spec.NATPortRange = portRange
+	default:
+		return nil, fmt.Errorf("%w %s=%q: unsupported next hop type", errInvalidAnnotation, metalloadbalancerv1alpha1.ServiceNextHopTypeAnnotation, value)
+	}
+	return spec, nil
+}
+
+// parsePortRange parses a port range of the form "<from>-<to>".
+func parsePortRange(value string) (*metalloadbalancerv1alpha1.PortRange, error) {
+	fromValue, toValue, ok := strings.Cut(value, "-")
+	if !ok {
+		return nil, fmt.Errorf("port range %q is not of the form <from>-<to>", value)
+	}
+	from, err := strconv.ParseUint(fromValue, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %w", fromValue, err)
+	}
+	to, err := strconv.ParseUint(toValue, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %w", toValue, err)
+	}
+	if from == 0 || from > to {
+		return nil, fmt.Errorf("invalid port range %q", value)
+	}
+	return &metalloadbalancerv1alpha1.PortRange{From: int32(from), To: int32(to)}, nil
+}
+
+func (r *ServiceReconciler) nextHop(nodeAddress netip.Addr, vni metalbond.VNI, spec metalloadbalancerv1alpha1.NextHop) metalbond.NextHop {
+	nextHop := metalbond.NextHop{
+		TargetAddress: nodeAddress,
+		TargetVNI:     uint32(vni),
+		Type:          pb.NextHopType_STANDARD,
+	}
+	switch spec.Type {
+	case metalloadbalancerv1alpha1.NextHopTypeNAT:
+		nextHop.Type = pb.NextHopType_NAT
+		if spec.NATPortRange != nil {
+			nextHop.NATPortRangeFrom = uint16(spec.NATPortRange.From)
+			nextHop.NATPortRangeTo = uint16(spec.NATPortRange.To)
+		}
+	case metalloadbalancerv1alpha1.NextHopTypeLoadBalancerTarget:
+		nextHop.Type = pb.NextHopType_LOADBALANCER_TARGET
+	}
+	return nextHop
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	"github.com/ironcore-dev/metalbond"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Next hops", func() {
+	DescribeTable("serviceVNI",
+		func(ctx SpecContext, value string, want metalbond.VNI, invalid bool) {
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{metalloadbalancerv1alpha1.ServiceVNIAnnotation: value},
+			}}
+			vni, err := (&ServiceReconciler{}).serviceVNI(ctx, service)
+			if invalid {
+				Expect(err).To(MatchError(errInvalidAnnotation))
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vni).To(Equal(want))
+		},
+		Entry("valid", "200", metalbond.VNI(200), false),
+		Entry("max", "16777215", metalbond.VNI(16777215), false),
+		Entry("above 24 bit", "16777216", metalbond.VNI(0), true),
+		Entry("negative", "-1", metalbond.VNI(0), true),
+		Entry("not a number", "foo", metalbond.VNI(0), true),
+	)
+
+	DescribeTable("nextHopFromAnnotations",
+		func(annotations map[string]string, want *metalloadbalancerv1alpha1.NextHop, invalid bool) {
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+			spec, err := nextHopFromAnnotations(service)
+			if invalid {
+				Expect(err).To(MatchError(errInvalidAnnotation))
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(spec).To(Equal(want))
+		},
+		Entry("none", nil, nil, false),
+		Entry("standard",
+			map[string]string{metalloadbalancerv1alpha1.ServiceNextHopTypeAnnotation: "Standard"},
+			&metalloadbalancerv1alpha1.NextHop{Type: metalloadbalancerv1alpha1.NextHopTypeStandard},
+			false,
+		),
+		Entry("nat",
+			map[string]string{
+				metalloadbalancerv1alpha1.ServiceNextHopTypeAnnotation:  "NAT",
+				metalloadbalancerv1alpha1.ServiceNATPortRangeAnnotation: "1024-2047",
+			},
+			&metalloadbalancerv1alpha1.NextHop{
+				Type:         metalloadbalancerv1alpha1.NextHopTypeNAT,
+				NATPortRange: &metalloadbalancerv1alpha1.PortRange{From: 1024, To: 2047},
+			},
+			false,
+		),
+		Entry("nat without port range",
+			map[string]string{metalloadbalancerv1alpha1.ServiceNextHopTypeAnnotation: "NAT"},
+			nil,
+			true,
+		),
+		Entry("nat with reversed port range",
+			map[string]string{
+				metalloadbalancerv1alpha1.ServiceNextHopTypeAnnotation:  "NAT",
+				metalloadbalancerv1alpha1.ServiceNATPortRangeAnnotation: "2047-1024",
+			},
+			nil,
+			true,
+		),
+		Entry("unsupported type",
+			map[string]string{metalloadbalancerv1alpha1.ServiceNextHopTypeAnnotation: "Foo"},
+			nil,
+			true,
+		),
+	)
+})
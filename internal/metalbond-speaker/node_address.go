@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"fmt"
+	"net/netip"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultNodeAddressTypes are the address types used as next hop, in order of preference.
+var DefaultNodeAddressTypes = []corev1.NodeAddressType{corev1.NodeInternalIP, corev1.NodeExternalIP}
+
+// NodeAddressSelector selects the address of a Node that is announced as next hop.
+type NodeAddressSelector struct {
+	// Types are the address types to consider, in order of preference.
+	Types []corev1.NodeAddressType
+	// Family is the IP family of the address. If empty, addresses of any family are considered.
+	Family corev1.IPFamily
+}
+
+// Validate checks the address types and the IP family of the selector.
+func (s NodeAddressSelector) Validate() error {
+	if len(s.Types) == 0 {
+		return fmt.Errorf("no node address types given")
+	}
+	for _, addressType := range s.Types {
+		switch addressType {
+		case corev1.NodeInternalIP, corev1.NodeExternalIP:
+		default:
+			return fmt.Errorf("unsupported node address type %q", addressType)
+		}
+	}
+	switch s.Family {
+	case "", corev1.IPv4Protocol, corev1.IPv6Protocol:
+	default:
+		return fmt.Errorf("unsupported IP family %q", s.Family)
+	}
+	return nil
+}
+
+// Select returns the first address of the Node matching the preferred types and the IP family.
+func (s NodeAddressSelector) Select(node *corev1.Node) (netip.Addr, error) {
+	for _, addressType := range s.Types {
+		for _, address := range node.Status.Addresses {
+			if address.Type != addressType {
+				continue
+			}
+			addr, err := netip.ParseAddr(address.Address)
+			if err != nil {
+				continue
+			}
+			if s.Family == "" || (s.Family == corev1.IPv4Protocol) == addr.Is4() {
+				return addr, nil
+			}
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("node %s has no %s address of types %v", node.Name, s.Family, s.Types)
+}
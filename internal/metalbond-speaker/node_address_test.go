@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"net/netip"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("NodeAddressSelector", func() {
+	addresses := []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: "node"},
+		{Type: corev1.NodeExternalIP, Address: "2001:db8::2"},
+		{Type: corev1.NodeInternalIP, Address: "192.0.2.1"},
+		{Type: corev1.NodeInternalIP, Address: "2001:db8::1"},
+	}
+
+	DescribeTable("Select",
+		func(selector NodeAddressSelector, want string) {
+			addr, err := selector.Select(&corev1.Node{Status: corev1.NodeStatus{Addresses: addresses}})
+			if want == "" {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addr).To(Equal(netip.MustParseAddr(want)))
+		},
+		Entry("preferred type and family",
+			NodeAddressSelector{Types: DefaultNodeAddressTypes, Family: corev1.IPv6Protocol}, "2001:db8::1"),
+		Entry("other family",
+			NodeAddressSelector{Types: DefaultNodeAddressTypes, Family: corev1.IPv4Protocol}, "192.0.2.1"),
+		Entry("any family",
+			NodeAddressSelector{Types: DefaultNodeAddressTypes}, "192.0.2.1"),
+		Entry("order of preference",
+			NodeAddressSelector{Types: []corev1.NodeAddressType{corev1.NodeExternalIP, corev1.NodeInternalIP}}, "2001:db8::2"),
+		Entry("no matching address",
+			NodeAddressSelector{Types: []corev1.NodeAddressType{corev1.NodeExternalIP}, Family: corev1.IPv4Protocol}, ""),
+	)
+
+	DescribeTable("Validate",
+		func(selector NodeAddressSelector, valid bool) {
+			if valid {
+				Expect(selector.Validate()).To(Succeed())
+			} else {
+				Expect(selector.Validate()).NotTo(Succeed())
+			}
+		},
+		Entry("default", NodeAddressSelector{Types: DefaultNodeAddressTypes, Family: corev1.IPv6Protocol}, true),
+		Entry("any family", NodeAddressSelector{Types: DefaultNodeAddressTypes}, true),
+		Entry("no types", NodeAddressSelector{}, false),
+		Entry("unsupported type", NodeAddressSelector{Types: []corev1.NodeAddressType{corev1.NodeHostName}}, false),
+		Entry("unsupported family", NodeAddressSelector{Types: DefaultNodeAddressTypes, Family: "IPv5"}, false),
+	)
+})
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/ironcore-dev/metalbond"
+)
+
+// Peer is the metalbond session of the speaker with a single server. Every server gets its own MetalBond
+// instance, since a MetalBond instance stops distributing an announcement at the first peer that fails
+// to receive it.
+type Peer struct {
+	Server    string
+	MetalBond *metalbond.MetalBond
+
+	client *routeListingClient
+}
+
+// NewPeers returns a Peer with its own MetalBond instance for each of the given servers.
+func NewPeers(servers []string, config metalbond.Config) []Peer {
+	peers := make([]Peer, 0, len(servers))
+	for _, server := range servers {
+		client := &routeListingClient{}
+		peers = append(peers, Peer{
+			Server:    server,
+			MetalBond: metalbond.NewMetalBond(config, client),
+			client:    client,
+		})
+	}
+	return peers
+}
+
+// AnnouncedRoutes returns the routes the MetalBond instance of the peer announces in the given VNI.
+func (p Peer) AnnouncedRoutes(vni metalbond.VNI) ([]Route, error) {
+	routes, err := p.client.list(p.MetalBond, vni)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes of metalbond peer %s: %w", p.Server, err)
+	}
+	// The listing also contains the routes received from the server.
+	return slices.DeleteFunc(routes, func(route Route) bool {
+		return !p.MetalBond.IsRouteAnnounced(route.VNI, route.Dest, route.NextHop)
+	}), nil
+}
+
+// routeListingClient is a metalbond.Client that does not install any routes. metalbond offers no way to list
+// the routes it announces other than replaying them to its client, which routeListingClient records on demand.
+type routeListingClient struct {
+	// listMu serializes listings, mu guards the recording.
+	listMu    sync.Mutex
+	mu        sync.Mutex
+	recording bool
+	routes    []Route
+}
+
+func (c *routeListingClient) AddRoute(vni metalbond.VNI, dest metalbond.Destination, nextHop metalbond.NextHop) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.recording {
+		c.routes = append(c.routes, Route{VNI: vni, Dest: dest, NextHop: nextHop})
+	}
+	return nil
+}
+
+func (c *routeListingClient) RemoveRoute(metalbond.VNI, metalbond.Destination, metalbond.NextHop) error {
+	return nil
+}
+
+// list returns the routes announced and received by the given MetalBond instance in the VNI.
+func (c *routeListingClient) list(mb *metalbond.MetalBond, vni metalbond.VNI) ([]Route, error) {
+	c.listMu.Lock()
+	defer c.listMu.Unlock()
+
+	c.mu.Lock()
+	c.recording, c.routes = true, nil
+	c.mu.Unlock()
+
+	err := mb.AddRoutesForVni(vni)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	routes := c.routes
+	c.recording, c.routes = false, nil
+	return routes, err
+}
+
+// CheckEstablished returns an error if the session with the server is not established.
+func (p Peer) CheckEstablished() error {
+	state, err := p.MetalBond.PeerState(p.Server)
+	if err != nil {
+		return fmt.Errorf("failed to get state of metalbond peer %s: %w", p.Server, err)
+	}
+	if state != metalbond.ESTABLISHED {
+		return fmt.Errorf("metalbond peer %s is %s", p.Server, state)
+	}
+	return nil
+}
+
+// anyPeerEstablished returns an error if the session with none of the given peers is established.
+func anyPeerEstablished(peers []Peer) error {
+	var errs []error
+	for _, peer := range peers {
+		err := peer.CheckEstablished()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("no metalbond peers configured")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"context"
+	"time"
+
+	"github.com/ironcore-dev/metalbond"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const peerStatePollInterval = time.Second
+
+// peerStateWatcher watches the state of a metalbond session and queues all Services whenever it changes, so
+// that the announced routes are reconciled against a restarted server and the ServiceAnnouncements report the
+// current state of the session.
+type peerStateWatcher struct {
+	reconciler *ServiceReconciler
+	peer       Peer
+	events     chan<- event.GenericEvent
+}
+
+func (w *peerStateWatcher) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("peer-state-watcher").WithValues("Server", w.peer.Server)
+
+	lastState := metalbond.CLOSED
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		state, err := w.peer.MetalBond.PeerState(w.peer.Server)
+		if err != nil {
+			// The peer is added by the Connector, which may not have run yet.
+			log.V(1).Info("Failed to get metalbond peer state", "Error", err.Error())
+			return
+		}
+		if state == lastState {
+			return
+		}
+		log.Info("Metalbond peer state changed", "OldState", lastState, "State", state)
+
+		if err := w.reconciler.resync(ctx, w.events); err != nil {
+			// Keep the old state so that the Services are queued again with the next poll.
+			log.Error(err, "Failed to queue Services")
+			return
+		}
+		lastState = state
+	}, peerStatePollInterval)
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every speaker watches its own session.
+func (w *peerStateWatcher) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// DefaultRouteGCInterval is the interval in which orphaned routes are withdrawn if the ServiceReconciler does not
+// configure one.
+const DefaultRouteGCInterval = 5 * time.Minute
+
+// routeGarbageCollector periodically compares the announced routes with the current Services. It queues every
+// Service that has routes recorded or should have routes, so the reconciler announces missing routes and
+// withdraws orphaned ones, e.g. of Services that were deleted while an event was missed. Routes metalbond
+// announces that are not recorded for any Service are withdrawn right away, and ServiceAnnouncements of deleted
+// nodes are deleted.
+//
+// Routes announced by a previous session, e.g. before the speaker restarted, cannot be listed or withdrawn
+// through a new session. The server drops them once the previous session closes.
+type routeGarbageCollector struct {
+	reconciler *ServiceReconciler
+	interval   time.Duration
+	events     chan<- event.GenericEvent
+}
+
+func (c *routeGarbageCollector) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("route-gc")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.collect(ctx); err != nil {
+			log.Error(err, "Failed to collect orphaned routes")
+		}
+	}, c.interval)
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every speaker has to collect its own routes.
+func (c *routeGarbageCollector) NeedLeaderElection() bool {
+	return false
+}
+
+func (c *routeGarbageCollector) collect(ctx context.Context) error {
+	return errors.Join(
+		c.reconciler.withdrawOrphanedRoutes(ctx),
+		c.reconciler.deleteStaleAnnouncements(ctx, ctrl.LoggerFrom(ctx).WithName("route-gc")),
+		c.reconciler.resync(ctx, c.events),
+	)
+}
+
+// withdrawOrphanedRoutes withdraws the routes metalbond announces in any subscribed VNI that are not recorded
+// for any Service or LoadBalancerIPPool.
+func (r *ServiceReconciler) withdrawOrphanedRoutes(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("route-gc")
+
+	r.routesMu.Lock()
+	defer r.routesMu.Unlock()
+
+	recorded := sets.New[Route]()
+	for _, key := range r.Routes.Keys() {
+		recorded = recorded.Union(r.Routes.Get(key))
+	}
+
+	var errs []error
+	for _, peer := range r.Peers {
+		for _, vni := range peer.MetalBond.GetSubscribedVnis() {
+			routes, err := peer.AnnouncedRoutes(vni)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for _, route := range routes {
+				if recorded.Has(route) {
+					continue
+				}
+				if err := peer.MetalBond.WithdrawRoute(route.VNI, route.Dest, route.NextHop); err != nil && peer.CheckEstablished() == nil {
+					errs = append(errs, fmt.Errorf("failed to withdraw orphaned route from metalbond peer %s: %w", peer.Server, err))
+					continue
+				}
+				log.Info("Withdrew orphaned route", "Server", peer.Server, "VNI", route.VNI, "Destination", route.Dest, "NextHop", route.NextHop)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// resync queues every Service that has routes recorded or should have routes.
+func (r *ServiceReconciler) resync(ctx context.Context, events chan<- event.GenericEvent) error {
+	serviceList := &corev1.ServiceList{}
+	if err := r.List(ctx, serviceList); err != nil {
+		return fmt.Errorf("failed to list Services: %w", err)
+	}
+
+	keys := sets.New[types.NamespacedName]()
+	for _, key := range r.Routes.Keys() {
+		// Routes of aggregated LoadBalancerIPPools are reconciled separately.
+		if !isPoolRoutesKey(key) {
+			keys.Insert(key)
+		}
+	}
+	for _, service := range serviceList.Items {
+		if r.isManagedLoadBalancer(&service) || controllerutil.ContainsFinalizer(&service, NodeFinalizer(r.NodeName)) {
+			keys.Insert(types.NamespacedName{Namespace: service.Namespace, Name: service.Name})
+		}
+	}
+
+	for _, key := range keys.UnsortedList() {
+		evt := event.GenericEvent{
+			Object: &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}},
+		}
+		select {
+		case events <- evt:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
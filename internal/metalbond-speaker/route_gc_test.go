@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"github.com/ironcore-dev/metalbond"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Route garbage collection", func() {
+	It("should withdraw routes that are not recorded for any Service", func() {
+		orphaned := standardRoute(defaultVNI, "192.0.2.250")
+		Expect(peers[0].MetalBond.AnnounceRoute(orphaned.VNI, orphaned.Dest, orphaned.NextHop)).To(Succeed())
+		DeferCleanup(func() {
+			if peers[0].MetalBond.IsRouteAnnounced(orphaned.VNI, orphaned.Dest, orphaned.NextHop) {
+				Expect(peers[0].MetalBond.WithdrawRoute(orphaned.VNI, orphaned.Dest, orphaned.NextHop)).To(Succeed())
+			}
+		})
+		Eventually(serverRoutes.Routes).Should(ContainElement(orphaned))
+
+		Eventually(peers[0].AnnouncedRoutes).WithArguments(metalbond.VNI(defaultVNI)).ShouldNot(ContainElement(orphaned))
+		Eventually(serverRoutes.Routes).ShouldNot(ContainElement(orphaned))
+	})
+})
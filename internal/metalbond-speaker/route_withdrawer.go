@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// routeWithdrawer withdraws all announced routes once the manager shuts down, so that no traffic is sent to
+// the node while the speaker is terminating. The next speaker on the node announces the routes again. Once the
+// routes are withdrawn, the ServiceAnnouncements of the node are deleted and the conditions of the Services are
+// updated, as far as the remaining shutdown time allows.
+type routeWithdrawer struct {
+	reconciler *ServiceReconciler
+}
+
+func (w *routeWithdrawer) Start(ctx context.Context) error {
+	<-ctx.Done()
+	log := ctrl.LoggerFrom(ctx).WithName("route-withdrawer")
+
+	log.Info("Withdrawing all routes")
+	keys := w.reconciler.Routes.Keys()
+	for _, key := range keys {
+		if err := w.reconciler.withdrawRoutes(log, key, w.reconciler.Routes.Get(key)); err != nil {
+			log.Error(err, "Failed to withdraw routes", "Service", key)
+		}
+	}
+
+	// Closing the sessions makes the servers drop whatever could not be withdrawn, and keeps reconciliations
+	// that are still in flight from announcing routes again.
+	for _, peer := range w.reconciler.Peers {
+		peer.MetalBond.Shutdown()
+	}
+	log.Info("Withdrew all routes")
+
+	// The manager stops waiting for the runnables once its graceful shutdown timeout expires.
+	ctx = context.WithoutCancel(ctx)
+	for _, key := range keys {
+		if isPoolRoutesKey(key) {
+			continue
+		}
+		if err := w.reportWithdrawn(ctx, log, key); err != nil {
+			log.Error(err, "Failed to report withdrawn routes", "Service", key)
+		}
+	}
+	return nil
+}
+
+// reportWithdrawn deletes the ServiceAnnouncement of the Service and updates its conditions.
+func (w *routeWithdrawer) reportWithdrawn(ctx context.Context, log logr.Logger, key types.NamespacedName) error {
+	service := &corev1.Service{}
+	if err := w.reconciler.Get(ctx, key, service); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if err := w.reconciler.deleteAnnouncement(ctx, log, service); err != nil {
+		return err
+	}
+	return w.reconciler.patchAnnouncedConditions(ctx, service, false)
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every speaker withdraws its own routes.
+func (w *routeWithdrawer) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"context"
+	"math"
+	"net/netip"
+	"time"
+
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	"github.com/ironcore-dev/metalbond"
+	"github.com/ironcore-dev/metalbond/pb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
+)
+
+var _ = Describe("routeWithdrawer", func() {
+	ns := SetupTest()
+
+	It("should withdraw all routes of the node and delete its ServiceAnnouncements on shutdown", func(ctx SpecContext) {
+		service := createLoadBalancerService(ctx, ns.Name, []string{"192.0.2.7"})
+
+		By("starting a second speaker on another node")
+		// The node is deleted before the Service, so that its finalizer is removed as stale.
+		const drainingNodeName, drainingNodeIP = "draining-node", "2001:db8:ff::2"
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: drainingNodeName}}
+		Expect(k8sClient.Create(ctx, node)).To(Succeed())
+		DeferCleanup(func(ctx context.Context) error {
+			return client.IgnoreNotFound(k8sClient.Delete(ctx, node))
+		})
+		node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: drainingNodeIP}}
+		Expect(k8sClient.Status().Update(ctx, node)).To(Succeed())
+
+		peer := NewPeers([]string{serverAddr}, metalbond.Config{KeepaliveInterval: 1})[0]
+		DeferCleanup(peer.MetalBond.Shutdown)
+		Expect((&Connector{
+			Peer:    peer,
+			VNI:     defaultVNI,
+			Backoff: wait.Backoff{Duration: 100 * time.Millisecond, Factor: 1, Steps: math.MaxInt32},
+		}).Start(ctx)).To(Succeed())
+
+		r := &ServiceReconciler{
+			Client:              k8sManager.GetClient(),
+			Scheme:              k8sManager.GetScheme(),
+			Recorder:            k8sManager.GetEventRecorder("metalbond-speaker"),
+			VNI:                 defaultVNI,
+			Peers:               []Peer{peer},
+			NodeName:            drainingNodeName,
+			NodeAddressSelector: NodeAddressSelector{Types: DefaultNodeAddressTypes, Family: corev1.IPv6Protocol},
+			Routes:              NewAnnouncedRoutes(),
+		}
+		Eventually(func(ctx context.Context) error {
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(service)})
+			return err
+		}).WithContext(ctx).Should(Succeed())
+
+		drainingRoute := hostRoute(defaultVNI, "192.0.2.7", metalbond.NextHop{
+			TargetAddress: netip.MustParseAddr(drainingNodeIP),
+			TargetVNI:     defaultVNI,
+			Type:          pb.NextHopType_STANDARD,
+		})
+		Eventually(serverRoutes.Routes).Should(ContainElements(drainingRoute, standardRoute(defaultVNI, "192.0.2.7")))
+		announcement := &metalloadbalancerv1alpha1.ServiceAnnouncement{ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns.Name,
+			Name:      ServiceAnnouncementName(service.Name, drainingNodeName),
+		}}
+		Eventually(Get(announcement)).Should(Succeed())
+
+		By("shutting down the second speaker")
+		shutdownCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		Expect((&routeWithdrawer{reconciler: r}).Start(shutdownCtx)).To(Succeed())
+
+		Eventually(serverRoutes.Routes).ShouldNot(ContainElement(drainingRoute))
+		Expect(serverRoutes.Routes()).To(ContainElement(standardRoute(defaultVNI, "192.0.2.7")))
+		Eventually(Get(announcement)).Should(Satisfy(apierrors.IsNotFound))
+	})
+})
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"sync"
+
+	"github.com/ironcore-dev/metalbond"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Route is a route announced by the speaker.
+type Route struct {
+	VNI     metalbond.VNI
+	Dest    metalbond.Destination
+	NextHop metalbond.NextHop
+}
+
+// AnnouncedRoutes keeps track of the routes the speaker announced for each Service, so that routes can be
+// withdrawn once they are no longer desired, e.g. because the ingress IPs of the Service changed. Several
+// Services may result in the same route, e.g. if they share an external IP, so routes are reference counted
+// and must only be withdrawn once no other Service holds them.
+type AnnouncedRoutes struct {
+	mu     sync.Mutex
+	routes map[types.NamespacedName]sets.Set[Route]
+	counts map[Route]int
+}
+
+// NewAnnouncedRoutes returns an empty AnnouncedRoutes.
+func NewAnnouncedRoutes() *AnnouncedRoutes {
+	return &AnnouncedRoutes{
+		routes: make(map[types.NamespacedName]sets.Set[Route]),
+		counts: make(map[Route]int),
+	}
+}
+
+// Get returns a copy of the routes announced for the given Service.
+func (a *AnnouncedRoutes) Get(key types.NamespacedName) sets.Set[Route] {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.routes[key].Clone()
+}
+
+// Set records the routes announced for the given Service. An empty set removes the Service.
+func (a *AnnouncedRoutes) Set(key types.NamespacedName, routes sets.Set[Route]) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.release(key)
+	if routes.Len() == 0 {
+		return
+	}
+	a.routes[key] = routes.Clone()
+	for route := range routes {
+		a.counts[route]++
+	}
+}
+
+// Delete removes all routes recorded for the given Service.
+func (a *AnnouncedRoutes) Delete(key types.NamespacedName) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.release(key)
+}
+
+func (a *AnnouncedRoutes) release(key types.NamespacedName) {
+	for route := range a.routes[key] {
+		if a.counts[route]--; a.counts[route] <= 0 {
+			delete(a.counts, route)
+		}
+	}
+	delete(a.routes, key)
+}
+
+// HeldByOthers reports whether the route is recorded for any Service other than the given one.
+func (a *AnnouncedRoutes) HeldByOthers(key types.NamespacedName, route Route) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	count := a.counts[route]
+	if a.routes[key].Has(route) {
+		count--
+	}
+	return count > 0
+}
+
+// Keys returns the Services routes are recorded for.
+func (a *AnnouncedRoutes) Keys() []types.NamespacedName {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	keys := make([]types.NamespacedName, 0, len(a.routes))
+	for key := range a.routes {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// All returns the distinct routes recorded for any Service. Routes shared by several Services are returned once.
+func (a *AnnouncedRoutes) All() sets.Set[Route] {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	routes := sets.New[Route]()
+	for route := range a.counts {
+		routes.Insert(route)
+	}
+	return routes
+}
@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"net/netip"
+
+	"github.com/ironcore-dev/metalbond"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+var _ = Describe("AnnouncedRoutes", func() {
+	shared := Route{VNI: 100, Dest: metalbond.Destination{Prefix: netip.MustParsePrefix("192.0.2.1/32")}}
+	own := Route{VNI: 100, Dest: metalbond.Destination{Prefix: netip.MustParsePrefix("192.0.2.2/32")}}
+	foo := types.NamespacedName{Namespace: "default", Name: "foo"}
+	bar := types.NamespacedName{Namespace: "default", Name: "bar"}
+
+	It("should count the Services holding a route", func() {
+		routes := NewAnnouncedRoutes()
+		routes.Set(foo, sets.New(shared, own))
+		Expect(routes.HeldByOthers(foo, shared)).To(BeFalse())
+
+		routes.Set(bar, sets.New(shared))
+		Expect(routes.HeldByOthers(foo, shared)).To(BeTrue())
+		Expect(routes.HeldByOthers(bar, shared)).To(BeTrue())
+		Expect(routes.HeldByOthers(bar, own)).To(BeTrue())
+		Expect(routes.HeldByOthers(foo, own)).To(BeFalse())
+
+		By("setting the routes of a Service again without counting them twice")
+		routes.Set(bar, sets.New(shared))
+		routes.Set(foo, sets.New(own))
+		Expect(routes.HeldByOthers(foo, shared)).To(BeTrue())
+		Expect(routes.HeldByOthers(bar, shared)).To(BeFalse())
+
+		By("deleting the routes of a Service")
+		routes.Delete(bar)
+		Expect(routes.HeldByOthers(foo, shared)).To(BeFalse())
+		Expect(routes.Keys()).To(ConsistOf(foo))
+
+		routes.Set(foo, sets.New[Route]())
+		Expect(routes.Keys()).To(BeEmpty())
+		Expect(routes.counts).To(BeEmpty())
+	})
+})
@@ -5,38 +5,109 @@ package metalbondspeaker
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
-	"github.com/ironcore-dev/controller-utils/clientutils"
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	"github.com/ironcore-dev/metal-load-balancer-controller/internal/prefixutils"
+	"github.com/ironcore-dev/metal-load-balancer-controller/internal/serviceutils"
 	"github.com/ironcore-dev/metalbond"
-	"github.com/ironcore-dev/metalbond/pb"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // ServiceReconciler reconciles a Service object
 type ServiceReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder events.EventRecorder
 
-	VNI         int
-	MetalBond   *metalbond.MetalBond
-	NodeAddress string
+	VNI      int
+	Peers    []Peer
+	NodeName string
+	// NodeAddress overrides the address of the Node announced as next hop. If empty, the address is
+	// selected from the Node by the NodeAddressSelector.
+	NodeAddress         string
+	NodeAddressSelector NodeAddressSelector
+	Routes              *AnnouncedRoutes
+
+	// RouteGCInterval is the interval in which orphaned routes are withdrawn. Defaults to DefaultRouteGCInterval.
+	RouteGCInterval time.Duration
+
+	LoadBalancerClass           string
+	IncludeServicesWithoutClass bool
+
+	// NodeSelector restricts the Services announced by this node to nodes matching the selector.
+	// It is overridden by the node selector annotation of a Service.
+	NodeSelector labels.Selector
+
+	// startTime is the time the reconciler was set up. Services created before it may have been announced by a
+	// previous instance of the speaker, so their first announcement is not observed.
+	startTime time.Time
+
+	// routesMu serializes announcing and withdrawing routes, so that a route shared by several Services is
+	// not withdrawn while it is announced for another one.
+	routesMu sync.Mutex
 }
 
 var (
+	// ServiceFinalizer is the finalizer formerly shared by all speakers. It is only removed anymore.
 	ServiceFinalizer = "metal-loadbalancer.ironcore.dev/service"
 )
 
+// sessionRequeueInterval is the interval in which Services are requeued while the metalbond session is down.
+const sessionRequeueInterval = 10 * time.Second
+
+// NodeFinalizerPrefix is the prefix of the finalizers each speaker adds to the Services it announces.
+const NodeFinalizerPrefix = serviceutils.NodeFinalizerPrefix
+
+// NodeFinalizer returns the finalizer of the speaker running on the node with the given name.
+func NodeFinalizer(nodeName string) string {
+	// The name part of a finalizer is limited to 63 characters while node names may be longer.
+	if len(nodeName) > validation.LabelValueMaxLength {
+		sum := sha256.Sum256([]byte(nodeName))
+		nodeName = nodeName[:50] + "-" + hex.EncodeToString(sum[:6])
+	}
+	return NodeFinalizerPrefix + nodeName
+}
+
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=services/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups="",resources=services/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=metal-loadbalancer.ironcore.dev,resources=vnimappings,verbs=get;list;watch
+// +kubebuilder:rbac:groups=metal-loadbalancer.ironcore.dev,resources=loadbalancerippools,verbs=get;list;watch
+// +kubebuilder:rbac:groups=metal-loadbalancer.ironcore.dev,resources=serviceannouncements,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=metal-loadbalancer.ironcore.dev,resources=serviceannouncements/status,verbs=get;update;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -44,7 +115,14 @@ func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	log := ctrl.LoggerFrom(ctx)
 	service := &corev1.Service{}
 	if err := r.Get(ctx, req.NamespacedName, service); err != nil {
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		// The Service is gone, e.g. because its finalizers were removed by hand. Withdraw whatever is left.
+		return ctrl.Result{}, r.withdrawRoutes(log, req.NamespacedName, r.Routes.Get(req.NamespacedName))
+	}
+	if serviceutils.HasOtherLoadBalancerClass(service, r.LoadBalancerClass) {
+		return ctrl.Result{}, nil
 	}
 
 	return r.reconcileExists(ctx, log, service)
@@ -60,68 +138,673 @@ func (r *ServiceReconciler) reconcileExists(ctx context.Context, log logr.Logger
 func (r *ServiceReconciler) delete(ctx context.Context, log logr.Logger, service *corev1.Service) (ctrl.Result, error) {
 	log.V(1).Info("Deleting Service")
 
-	prefix := fmt.Sprintf("%s/128", service.Spec.ClusterIP)
-	dest := metalbond.Destination{
-		IPVersion: metalbond.IPV6,
-		Prefix:    netip.MustParsePrefix(prefix),
+	if err := r.cleanup(ctx, log, service); err != nil {
+		return ctrl.Result{}, err
 	}
-	nextHop := metalbond.NextHop{
-		TargetAddress: netip.MustParseAddr(r.NodeAddress),
-		TargetVNI:     uint32(r.VNI),
-		Type:          pb.NextHopType_STANDARD,
+
+	log.V(1).Info("Deleted Service")
+	return ctrl.Result{}, nil
+}
+
+// cleanup withdraws all routes of the Service, deletes its ServiceAnnouncement and removes the finalizer.
+func (r *ServiceReconciler) cleanup(ctx context.Context, log logr.Logger, service *corev1.Service) error {
+	// Routes are recorded before they are announced, so the recorded routes cover all announcements.
+	key := client.ObjectKeyFromObject(service)
+	if err := r.withdrawRoutes(log, key, r.Routes.Get(key)); err != nil {
+		return err
 	}
-	if err := r.MetalBond.WithdrawRoute(metalbond.VNI(r.VNI), dest, nextHop); err != nil {
-		return ctrl.Result{}, err
+	r.Routes.Delete(key)
+
+	if err := r.deleteAnnouncement(ctx, log, service); err != nil {
+		return err
+	}
+
+	staleFinalizers, err := r.staleNodeFinalizers(ctx, service)
+	if err != nil {
+		return err
 	}
-	log.V(1).Info("Removed route", "VNI", r.VNI, "Destination", dest, "NextHop", nextHop)
 
 	log.V(1).Info("Ensuring that the finalizer is removed")
-	if modified, err := clientutils.PatchEnsureNoFinalizer(ctx, r.Client, service, ServiceFinalizer); err != nil || modified {
-		return ctrl.Result{}, err
+	finalizers := append([]string{NodeFinalizer(r.NodeName), ServiceFinalizer}, staleFinalizers...)
+	if _, err := serviceutils.PatchEnsureNoFinalizers(ctx, r.Client, service, finalizers...); err != nil {
+		return err
 	}
+	return nil
+}
 
-	log.V(1).Info("Deleted Service")
-	return ctrl.Result{}, nil
+// staleNodeFinalizers returns the finalizers of speakers on nodes that no longer exist. Those speakers
+// will never withdraw their routes, so their finalizers must not block the deletion of the Service.
+func (r *ServiceReconciler) staleNodeFinalizers(ctx context.Context, service *corev1.Service) ([]string, error) {
+	nodeList := &corev1.NodeList{}
+	if err := r.List(ctx, nodeList); err != nil {
+		return nil, fmt.Errorf("failed to list Nodes: %w", err)
+	}
+
+	nodeFinalizers := sets.New[string]()
+	for _, node := range nodeList.Items {
+		nodeFinalizers.Insert(NodeFinalizer(node.Name))
+	}
+
+	var staleFinalizers []string
+	for _, finalizer := range service.Finalizers {
+		if strings.HasPrefix(finalizer, NodeFinalizerPrefix) && !nodeFinalizers.Has(finalizer) {
+			staleFinalizers = append(staleFinalizers, finalizer)
+		}
+	}
+	return staleFinalizers, nil
 }
 
 func (r *ServiceReconciler) reconcile(ctx context.Context, log logr.Logger, service *corev1.Service) (ctrl.Result, error) {
-	if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
-		return ctrl.Result{}, nil
+	if !r.isManagedLoadBalancer(service) {
+		if !controllerutil.ContainsFinalizer(service, NodeFinalizer(r.NodeName)) &&
+			!controllerutil.ContainsFinalizer(service, ServiceFinalizer) &&
+			r.Routes.Get(client.ObjectKeyFromObject(service)).Len() == 0 {
+			return ctrl.Result{}, nil
+		}
+		log.V(1).Info("Service is no longer a managed LoadBalancer")
+		return ctrl.Result{}, r.cleanup(ctx, log, service)
 	}
 
-	if modified, err := clientutils.PatchEnsureFinalizer(ctx, r.Client, service, ServiceFinalizer); err != nil || modified {
-		return ctrl.Result{}, err
+	if err := anyPeerEstablished(r.Peers); err != nil {
+		log.V(1).Info("Metalbond session is not established, requeueing", "Reason", err.Error())
+		if err := r.updateAnnouncementPeers(ctx, log, service); err != nil {
+			log.Error(err, "Failed to report metalbond session state")
+		}
+		return ctrl.Result{RequeueAfter: sessionRequeueInterval}, nil
 	}
-	log.V(1).Info("Ensured finalizer has been added")
 
-	prefix := fmt.Sprintf("%s/128", service.Spec.ClusterIP)
-	dest := metalbond.Destination{
-		// TODO:
-		IPVersion: metalbond.IPV6,
-		Prefix:    netip.MustParsePrefix(prefix),
+	key := client.ObjectKeyFromObject(service)
+	nodeAddress, err := r.nodeAddress(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
 	}
-	nextHop := metalbond.NextHop{
-		TargetAddress: netip.MustParseAddr(r.NodeAddress),
-		TargetVNI:     uint32(r.VNI),
-		Type:          pb.NextHopType_STANDARD,
+	routes, aggregated, err := r.serviceRoutes(ctx, service, nodeAddress)
+	announce := false
+	if err == nil {
+		announce, err = r.shouldAnnounce(ctx, log, service)
+	}
+	if errors.Is(err, errInvalidAnnotation) {
+		r.Recorder.Eventf(service, nil, corev1.EventTypeWarning, "InvalidAnnotation", "Announce",
+			"Node %s is unable to announce routes: %v", r.NodeName, err)
+		// Retrying does not help until the Service is changed. The routes announced so far are kept.
+		return ctrl.Result{}, r.patchAnnouncementFailedCondition(ctx, service, "InvalidAnnotation", err)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !announce {
+		routes = sets.New[Route]()
+		aggregated = sets.New[Route]()
+	}
+
+	// The finalizer is added before announcing, so that the Service is not deleted before the routes are withdrawn.
+	if routes.Len() > 0 {
+		if _, err := serviceutils.PatchEnsureFinalizer(ctx, r.Client, service, NodeFinalizer(r.NodeName)); err != nil {
+			return ctrl.Result{}, err
+		}
+		log.V(1).Info("Ensured finalizer has been added")
 	}
 
-	if !r.MetalBond.IsRouteAnnounced(metalbond.VNI(r.VNI), dest, nextHop) {
-		if err := r.MetalBond.AnnounceRoute(metalbond.VNI(r.VNI), dest, nextHop); err != nil {
+	if err := r.applyRoutes(log, key, routes); err != nil {
+		r.Recorder.Eventf(service, nil, corev1.EventTypeWarning, "AnnouncementFailed", "Announce",
+			"Node %s failed to announce routes: %v", r.NodeName, err)
+		if condErr := r.patchAnnouncementFailedCondition(ctx, service, "AnnouncementFailed", err); condErr != nil {
+			log.Error(condErr, "Failed to report announcement failure")
+		}
+		return ctrl.Result{}, err
+	}
+	// The node no longer announces routes of its own for the Service, so it does not block its deletion anymore.
+	if routes.Len() == 0 {
+		if _, err := serviceutils.PatchEnsureNoFinalizers(ctx, r.Client, service, NodeFinalizer(r.NodeName), ServiceFinalizer); err != nil {
 			return ctrl.Result{}, err
 		}
+		log.V(1).Info("Ensured finalizer has been removed")
 	}
 
+	// Aggregated routes are announced separately, but are reported for every Service they cover.
+	announced := routes.Union(aggregated)
+	if err := r.updateAnnouncement(ctx, log, service, announced); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.patchAnnouncedConditions(ctx, service, announced.Len() > 0); err != nil {
+		return ctrl.Result{}, err
+	}
 	return ctrl.Result{}, nil
 }
 
+// applyRoutes announces the given routes and withdraws all other routes recorded for the key.
+func (r *ServiceReconciler) applyRoutes(log logr.Logger, key types.NamespacedName, routes sets.Set[Route]) error {
+	r.routesMu.Lock()
+	defer r.routesMu.Unlock()
+
+	// Keep track of the new routes before announcing them, so that they are withdrawn even if announcing fails halfway.
+	announced := r.Routes.Get(key)
+	r.Routes.Set(key, announced.Union(routes))
+
+	if err := r.withdrawRoutesLocked(log, key, announced.Difference(routes)); err != nil {
+		return err
+	}
+	for _, route := range routes.UnsortedList() {
+		if err := r.announceRoute(log, route); err != nil {
+			return err
+		}
+	}
+	r.Routes.Set(key, routes)
+	return nil
+}
+
+// withdrawRoutes withdraws the given routes of the Service and stops tracking them.
+func (r *ServiceReconciler) withdrawRoutes(log logr.Logger, key client.ObjectKey, routes sets.Set[Route]) error {
+	r.routesMu.Lock()
+	defer r.routesMu.Unlock()
+	return r.withdrawRoutesLocked(log, key, routes)
+}
+
+// withdrawRoutesLocked withdraws the given routes of the Service and stops tracking them. Routes still held
+// by other Services are only no longer tracked for the Service. The caller has to hold routesMu.
+func (r *ServiceReconciler) withdrawRoutesLocked(log logr.Logger, key client.ObjectKey, routes sets.Set[Route]) error {
+	for _, route := range routes.UnsortedList() {
+		if !r.Routes.HeldByOthers(key, route) {
+			if err := r.withdrawRoute(log, route); err != nil {
+				return err
+			}
+		}
+		r.Routes.Set(key, r.Routes.Get(key).Delete(route))
+	}
+	return nil
+}
+
+// announceRoute announces the route to all peers. Peers without an established session receive the route once
+// their session is established.
+func (r *ServiceReconciler) announceRoute(log logr.Logger, route Route) error {
+	for _, peer := range r.Peers {
+		// Services may be announced in VNIs other than the default one, which are subscribed on demand.
+		if !peer.MetalBond.IsSubscribed(route.VNI) {
+			if err := peer.MetalBond.Subscribe(route.VNI); err != nil && peer.CheckEstablished() == nil {
+				return fmt.Errorf("failed to subscribe to VNI %d at metalbond peer %s: %w", route.VNI, peer.Server, err)
+			}
+			log.V(1).Info("Subscribed to VNI", "Server", peer.Server, "VNI", route.VNI)
+		}
+		if peer.MetalBond.IsRouteAnnounced(route.VNI, route.Dest, route.NextHop) {
+			continue
+		}
+		start := time.Now()
+		err := peer.MetalBond.AnnounceRoute(route.VNI, route.Dest, route.NextHop)
+		routeOperationDuration.WithLabelValues(operationAnnounce, peer.Server).Observe(time.Since(start).Seconds())
+		if err != nil {
+			routeOperationErrors.WithLabelValues(operationAnnounce, peer.Server).Inc()
+			if peer.CheckEstablished() == nil {
+				return fmt.Errorf("failed to announce route to metalbond peer %s: %w", peer.Server, err)
+			}
+		}
+		log.V(1).Info("Announced route", "Server", peer.Server, "VNI", route.VNI, "Destination", route.Dest, "NextHop", route.NextHop)
+	}
+	return nil
+}
+
+// withdrawRoute withdraws the route from all peers. Peers without an established session already dropped the route.
+func (r *ServiceReconciler) withdrawRoute(log logr.Logger, route Route) error {
+	for _, peer := range r.Peers {
+		// A previous attempt may have already withdrawn the route.
+		if !peer.MetalBond.IsRouteAnnounced(route.VNI, route.Dest, route.NextHop) {
+			continue
+		}
+		start := time.Now()
+		err := peer.MetalBond.WithdrawRoute(route.VNI, route.Dest, route.NextHop)
+		routeOperationDuration.WithLabelValues(operationWithdraw, peer.Server).Observe(time.Since(start).Seconds())
+		if err != nil {
+			routeOperationErrors.WithLabelValues(operationWithdraw, peer.Server).Inc()
+			if peer.CheckEstablished() == nil {
+				return fmt.Errorf("failed to withdraw route from metalbond peer %s: %w", peer.Server, err)
+			}
+		}
+		log.V(1).Info("Removed route", "Server", peer.Server, "VNI", route.VNI, "Destination", route.Dest, "NextHop", route.NextHop)
+	}
+	return nil
+}
+
+// serviceRoutes returns the routes the speaker has to announce for the given Service, and the aggregated routes
+// of its LoadBalancerIPPools covering its addresses instead.
+func (r *ServiceReconciler) serviceRoutes(ctx context.Context, service *corev1.Service, nodeAddress netip.Addr) (routes, aggregated sets.Set[Route], err error) {
+	ips, err := r.serviceIPs(ctx, service)
+	if err != nil {
+		return nil, nil, err
+	}
+	dests, err := serviceDestinations(ips)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vni, err := r.serviceVNI(ctx, service)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pools, err := r.servicePools(ctx, service)
+	if err != nil {
+		return nil, nil, err
+	}
+	annotatedSpec, err := nextHopFromAnnotations(service)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	routes = sets.New[Route]()
+	aggregated = sets.New[Route]()
+	for _, dest := range dests {
+		pool := pools[dest.Prefix.Addr()]
+		covered, err := r.coveredByAggregate(ctx, service, pool, vni, annotatedSpec)
+		if err != nil {
+			return nil, nil, err
+		}
+		if covered {
+			aggregated = aggregated.Union(r.aggregatedRoutes(pool, dest))
+			continue
+		}
+
+		spec := metalloadbalancerv1alpha1.NextHop{Type: metalloadbalancerv1alpha1.NextHopTypeStandard}
+		switch {
+		case annotatedSpec != nil:
+			spec = *annotatedSpec
+		case pool != nil && pool.Spec.NextHop != nil:
+			spec = *pool.Spec.NextHop
+		}
+		routes.Insert(Route{VNI: vni, Dest: dest, NextHop: r.nextHop(nodeAddress, vni, spec)})
+	}
+	return routes, aggregated, nil
+}
+
+func (r *ServiceReconciler) isManagedLoadBalancer(service *corev1.Service) bool {
+	return service.Spec.Type == corev1.ServiceTypeLoadBalancer &&
+		serviceutils.MatchesLoadBalancerClass(service, r.LoadBalancerClass, r.IncludeServicesWithoutClass)
+}
+
+// nodeAddress returns the address of this node that is announced as next hop.
+func (r *ServiceReconciler) nodeAddress(ctx context.Context) (netip.Addr, error) {
+	if r.NodeAddress != "" {
+		return netip.ParseAddr(r.NodeAddress)
+	}
+
+	node := &corev1.Node{}
+	if err := r.Get(ctx, client.ObjectKey{Name: r.NodeName}, node); err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to get Node %s: %w", r.NodeName, err)
+	}
+	return r.NodeAddressSelector.Select(node)
+}
+
+// serviceVNI returns the VNI of the annotation of the Service, of the VNIMapping of its namespace, or the
+// default VNI, in that order.
+func (r *ServiceReconciler) serviceVNI(ctx context.Context, service *corev1.Service) (metalbond.VNI, error) {
+	if value, ok := service.Annotations[metalloadbalancerv1alpha1.ServiceVNIAnnotation]; ok {
+		// VNIs are 24 bits wide.
+		vni, err := strconv.ParseUint(value, 10, 24)
+		if err != nil {
+			return 0, fmt.Errorf("%w %s=%q: %w", errInvalidAnnotation, metalloadbalancerv1alpha1.ServiceVNIAnnotation, value, err)
+		}
+		return metalbond.VNI(vni), nil
+	}
+
+	mapping, err := serviceutils.GetVNIMapping(ctx, r.Client, service)
+	if err != nil {
+		return 0, err
+	}
+	if mapping != nil {
+		return metalbond.VNI(mapping.Spec.VNI), nil
+	}
+	return metalbond.VNI(r.VNI), nil
+}
+
+// serviceIPs returns the LoadBalancer ingress IPs and the external IPs of the given Service. External IPs are set
+// by users without any allocation, so only those within a LoadBalancerIPPool that are not allocated to another
+// Service are returned. Announcing others would hijack addresses the Service has no claim on.
+func (r *ServiceReconciler) serviceIPs(ctx context.Context, service *corev1.Service) ([]string, error) {
+	ips := sets.New[string]()
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			ips.Insert(ingress.IP)
+		}
+	}
+	if len(service.Spec.ExternalIPs) == 0 {
+		return sets.List(ips), nil
+	}
+
+	poolList := &metalloadbalancerv1alpha1.LoadBalancerIPPoolList{}
+	if err := r.List(ctx, poolList); err != nil {
+		return nil, fmt.Errorf("failed to list LoadBalancerIPPools: %w", err)
+	}
+	for _, ip := range service.Spec.ExternalIPs {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil || !externalIPAllowed(poolList.Items, service, addr) {
+			r.Recorder.Eventf(service, nil, corev1.EventTypeWarning, "ExternalIPNotAllowed", "Announce",
+				"External IP %s is not within a LoadBalancerIPPool or is allocated to another Service", ip)
+			continue
+		}
+		ips.Insert(addr.String())
+	}
+	return sets.List(ips), nil
+}
+
+// externalIPAllowed reports whether the address is within the CIDRs of one of the pools, not excluded from it and
+// not allocated to another Service than the given one.
+func externalIPAllowed(pools []metalloadbalancerv1alpha1.LoadBalancerIPPool, service *corev1.Service, addr netip.Addr) bool {
+	for _, pool := range pools {
+		cidrs, err := prefixutils.Parse(pool.Spec.CIDRs)
+		if err != nil || !slices.ContainsFunc(cidrs, func(cidr netip.Prefix) bool { return cidr.Contains(addr) }) {
+			continue
+		}
+		exclusions, err := prefixutils.Parse(pool.Spec.Exclusions)
+		if err != nil || slices.ContainsFunc(exclusions, func(exclusion netip.Prefix) bool { return exclusion.Contains(addr) }) {
+			return false
+		}
+		for _, allocation := range pool.Status.Allocations {
+			if allocated, err := netip.ParseAddr(allocation.IP); err == nil && allocated == addr && allocation.ServiceRef.UID != service.UID {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// serviceDestinations returns the host route destinations for the given IPs.
+func serviceDestinations(ips []string) ([]metalbond.Destination, error) {
+	dests := make([]metalbond.Destination, 0, len(ips))
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP %q: %w", ip, err)
+		}
+
+		ipVersion := metalbond.IPV6
+		if addr.Is4() {
+			ipVersion = metalbond.IPV4
+		}
+		dests = append(dests, metalbond.Destination{
+			IPVersion: ipVersion,
+			Prefix:    netip.PrefixFrom(addr, addr.BitLen()),
+		})
+	}
+	return dests, nil
+}
+
+// shouldAnnounce reports whether this node has to announce the Service.
+func (r *ServiceReconciler) shouldAnnounce(ctx context.Context, log logr.Logger, service *corev1.Service) (bool, error) {
+	ok, err := r.nodeMatchesSelector(ctx, service)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		log.V(1).Info("Node does not match the node selector of the Service")
+		return false, nil
+	}
+
+	if service.Spec.ExternalTrafficPolicy == corev1.ServiceExternalTrafficPolicyLocal {
+		// Traffic is only delivered to endpoints on the receiving node, so only nodes with endpoints may announce.
+		ok, err := r.hasReadyLocalEndpoint(ctx, service)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			log.V(1).Info("Service has no ready endpoint on this node")
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// nodeMatchesSelector reports whether this node matches the node selector of the Service annotation or,
+// if the Service has none, the node selector of the speaker.
+func (r *ServiceReconciler) nodeMatchesSelector(ctx context.Context, service *corev1.Service) (bool, error) {
+	selector := r.NodeSelector
+	if value, ok := service.Annotations[metalloadbalancerv1alpha1.ServiceNodeSelectorAnnotation]; ok {
+		var err error
+		if selector, err = labels.Parse(value); err != nil {
+			return false, fmt.Errorf("%w %s=%q: %w", errInvalidAnnotation, metalloadbalancerv1alpha1.ServiceNodeSelectorAnnotation, value, err)
+		}
+	}
+	return r.nodeMatches(ctx, selector)
+}
+
+// nodeMatches reports whether this node matches the given selector. A nil selector matches every node.
+func (r *ServiceReconciler) nodeMatches(ctx context.Context, selector labels.Selector) (bool, error) {
+	if selector == nil || selector.Empty() {
+		return true, nil
+	}
+
+	node := &corev1.Node{}
+	if err := r.Get(ctx, client.ObjectKey{Name: r.NodeName}, node); err != nil {
+		return false, fmt.Errorf("failed to get Node %s: %w", r.NodeName, err)
+	}
+	return selector.Matches(labels.Set(node.Labels)), nil
+}
+
+// hasReadyLocalEndpoint reports whether any EndpointSlice of the Service has a ready endpoint on this node.
+func (r *ServiceReconciler) hasReadyLocalEndpoint(ctx context.Context, service *corev1.Service) (bool, error) {
+	endpointSliceList := &discoveryv1.EndpointSliceList{}
+	if err := r.List(ctx, endpointSliceList,
+		client.InNamespace(service.Namespace),
+		client.MatchingLabels{discoveryv1.LabelServiceName: service.Name},
+	); err != nil {
+		return false, fmt.Errorf("failed to list EndpointSlices: %w", err)
+	}
+
+	for _, endpointSlice := range endpointSliceList.Items {
+		for _, endpoint := range endpointSlice.Endpoints {
+			if endpoint.NodeName == nil || *endpoint.NodeName != r.NodeName {
+				continue
+			}
+			// A nil ready condition is to be interpreted as ready.
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// enqueueEndpointSliceService enqueues the Service the EndpointSlice belongs to if it is announced depending on
+// its local endpoints.
+func (r *ServiceReconciler) enqueueEndpointSliceService(ctx context.Context, obj client.Object) []ctrl.Request {
+	log := ctrl.LoggerFrom(ctx)
+	serviceName, ok := obj.GetLabels()[discoveryv1.LabelServiceName]
+	if !ok {
+		return nil
+	}
+
+	service := &corev1.Service{}
+	key := client.ObjectKey{Namespace: obj.GetNamespace(), Name: serviceName}
+	if err := r.Get(ctx, key, service); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Error(err, "failed to get Service", "Service", key)
+		}
+		return nil
+	}
+	if service.Spec.ExternalTrafficPolicy != corev1.ServiceExternalTrafficPolicyLocal {
+		return nil
+	}
+	return []ctrl.Request{{NamespacedName: key}}
+}
+
+// enqueueManagedServices enqueues all Services announced by the speaker.
+func (r *ServiceReconciler) enqueueManagedServices(ctx context.Context, _ client.Object) []ctrl.Request {
+	log := ctrl.LoggerFrom(ctx)
+	serviceList := &corev1.ServiceList{}
+	if err := r.List(ctx, serviceList); err != nil {
+		log.Error(err, "failed to list Services")
+		return nil
+	}
+
+	var reqs []ctrl.Request
+	for _, service := range serviceList.Items {
+		if r.isManagedLoadBalancer(&service) {
+			reqs = append(reqs, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&service)})
+		}
+	}
+	return reqs
+}
+
+// enqueueServicesWithExternalIPs enqueues the managed Services with external IPs, which may only be announced as
+// long as they are not allocated to other Services.
+func (r *ServiceReconciler) enqueueServicesWithExternalIPs(ctx context.Context, _ client.Object) []ctrl.Request {
+	log := ctrl.LoggerFrom(ctx)
+	serviceList := &corev1.ServiceList{}
+	if err := r.List(ctx, serviceList); err != nil {
+		log.Error(err, "failed to list Services")
+		return nil
+	}
+
+	var reqs []ctrl.Request
+	for _, service := range serviceList.Items {
+		if r.isManagedLoadBalancer(&service) && len(service.Spec.ExternalIPs) > 0 {
+			reqs = append(reqs, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&service)})
+		}
+	}
+	return reqs
+}
+
+// enqueueNamespaceServices enqueues all Services of the Namespace announced by the speaker.
+func (r *ServiceReconciler) enqueueNamespaceServices(ctx context.Context, obj client.Object) []ctrl.Request {
+	log := ctrl.LoggerFrom(ctx)
+	serviceList := &corev1.ServiceList{}
+	if err := r.List(ctx, serviceList, client.InNamespace(obj.GetName())); err != nil {
+		log.Error(err, "failed to list Services", "Namespace", obj.GetName())
+		return nil
+	}
+
+	var reqs []ctrl.Request
+	for _, service := range serviceList.Items {
+		if r.isManagedLoadBalancer(&service) {
+			reqs = append(reqs, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&service)})
+		}
+	}
+	return reqs
+}
+
+// enqueueServicesOfDeletedNode enqueues all Services announced by the speaker, whose Announced condition may
+// depend on the deleted node, and all Services in deletion that still carry finalizers of speakers.
+func (r *ServiceReconciler) enqueueServicesOfDeletedNode(ctx context.Context, _ client.Object) []ctrl.Request {
+	log := ctrl.LoggerFrom(ctx)
+	serviceList := &corev1.ServiceList{}
+	if err := r.List(ctx, serviceList); err != nil {
+		log.Error(err, "failed to list Services")
+		return nil
+	}
+
+	var reqs []ctrl.Request
+	for _, service := range serviceList.Items {
+		if r.isManagedLoadBalancer(&service) ||
+			(!service.DeletionTimestamp.IsZero() && serviceutils.HasNodeFinalizers(&service)) {
+			reqs = append(reqs, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&service)})
+		}
+	}
+	return reqs
+}
+
+// nodeChangedPredicates filter for changes of the labels or the addresses of this node.
+func (r *ServiceReconciler) nodeChangedPredicates() []predicate.Predicate {
+	return []predicate.Predicate{
+		predicate.NewPredicateFuncs(func(obj client.Object) bool { return obj.GetName() == r.NodeName }),
+		predicate.Or(
+			predicate.LabelChangedPredicate{},
+			predicate.Funcs{
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					oldNode, newNode := e.ObjectOld.(*corev1.Node), e.ObjectNew.(*corev1.Node)
+					return !equality.Semantic.DeepEqual(oldNode.Status.Addresses, newNode.Status.Addresses)
+				},
+			},
+		),
+	}
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.startTime = time.Now()
+	if err := metrics.Registry.Register(&speakerCollector{routes: r.Routes, peers: r.Peers}); err != nil {
+		return fmt.Errorf("failed to register speaker metrics: %w", err)
+	}
+
+	resyncEvents := make(chan event.GenericEvent)
+	interval := r.RouteGCInterval
+	if interval <= 0 {
+		interval = DefaultRouteGCInterval
+	}
+	if err := mgr.Add(&routeGarbageCollector{
+		reconciler: r,
+		interval:   interval,
+		events:     resyncEvents,
+	}); err != nil {
+		return err
+	}
+	if err := mgr.Add(&routeWithdrawer{reconciler: r}); err != nil {
+		return err
+	}
+	for _, peer := range r.Peers {
+		if err := mgr.Add(&peerStateWatcher{
+			reconciler: r,
+			peer:       peer,
+			events:     resyncEvents,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := r.setupAggregationWithManager(mgr, resyncEvents); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Service{}, builder.WithPredicates(predicate.NewPredicateFuncs(
 			func(obj client.Object) bool {
+				// Services that stopped being a managed LoadBalancer still need their routes withdrawn.
 				service := obj.(*corev1.Service)
-				return service.Spec.Type == corev1.ServiceTypeLoadBalancer
+				return r.isManagedLoadBalancer(service) ||
+					controllerutil.ContainsFinalizer(service, NodeFinalizer(r.NodeName)) ||
+					controllerutil.ContainsFinalizer(service, ServiceFinalizer)
 			}))).
+		Watches(
+			&discoveryv1.EndpointSlice{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueEndpointSliceService),
+		).
+		// LoadBalancerIPPools define the next hop of the allocated addresses.
+		Watches(
+			&metalloadbalancerv1alpha1.LoadBalancerIPPool{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueManagedServices),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		// The allocations of LoadBalancerIPPools define which external IPs may be announced.
+		Watches(
+			&metalloadbalancerv1alpha1.LoadBalancerIPPool{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueServicesWithExternalIPs),
+		).
+		// VNIMappings and the labels of Namespaces define the VNI of the Services.
+		Watches(
+			&metalloadbalancerv1alpha1.VNIMapping{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueManagedServices),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueNamespaceServices),
+			builder.WithPredicates(predicate.LabelChangedPredicate{}),
+		).
+		// Services have to be announced or withdrawn when the labels or the addresses of this node change.
+		Watches(
+			&corev1.Node{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueManagedServices),
+			builder.WithPredicates(r.nodeChangedPredicates()...),
+		).
+		// Deleted Nodes leave stale finalizers behind that have to be removed from Services in deletion, and no
+		// longer announce the Services.
+		Watches(
+			&corev1.Node{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueServicesOfDeletedNode),
+			builder.WithPredicates(predicate.Funcs{
+				CreateFunc:  func(event.CreateEvent) bool { return false },
+				UpdateFunc:  func(event.UpdateEvent) bool { return false },
+				DeleteFunc:  func(event.DeleteEvent) bool { return true },
+				GenericFunc: func(event.GenericEvent) bool { return false },
+			}),
+		).
+		WatchesRawSource(source.Channel(resyncEvents, &handler.EnqueueRequestForObject{})).
 		Complete(r)
 }
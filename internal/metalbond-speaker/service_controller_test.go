@@ -0,0 +1,439 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metalbondspeaker
+
+import (
+	"context"
+	"net/netip"
+
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	"github.com/ironcore-dev/metalbond"
+	"github.com/ironcore-dev/metalbond/pb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	gomegatypes "github.com/onsi/gomega/types"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
+)
+
+var _ = Describe("ServiceReconciler", func() {
+	ns := SetupTest()
+
+	It("should announce the ingress IP of a Service with the node as next hop", func(ctx SpecContext) {
+		service := createLoadBalancerService(ctx, ns.Name, []string{"192.0.2.1"})
+
+		By("announcing the route and adding the finalizer of the node")
+		Eventually(serverRoutes.Routes).Should(ContainElement(standardRoute(defaultVNI, "192.0.2.1")))
+		Eventually(Object(service)).Should(HaveField("Finalizers", ContainElement(NodeFinalizer(nodeName))))
+
+		By("deleting the Service")
+		Expect(k8sClient.Delete(ctx, service)).To(Succeed())
+
+		By("withdrawing the route and removing the finalizer")
+		Eventually(serverRoutes.Routes).ShouldNot(ContainElement(standardRoute(defaultVNI, "192.0.2.1")))
+		Eventually(Get(service)).Should(Satisfy(apierrors.IsNotFound))
+	})
+
+	It("should only hold the finalizer of the node while it announces routes", func(ctx SpecContext) {
+		service := createLoadBalancerService(ctx, ns.Name, nil)
+		Consistently(Object(service)).Should(HaveField("Finalizers", BeEmpty()))
+
+		By("publishing an ingress IP")
+		setIngress(service, "192.0.2.3")
+		Eventually(serverRoutes.Routes).Should(ContainElement(standardRoute(defaultVNI, "192.0.2.3")))
+		Eventually(Object(service)).Should(HaveField("Finalizers", ConsistOf(NodeFinalizer(nodeName))))
+
+		By("removing the ingress IP")
+		setIngress(service)
+		Eventually(serverRoutes.Routes).ShouldNot(ContainElement(standardRoute(defaultVNI, "192.0.2.3")))
+		Eventually(Object(service)).Should(HaveField("Finalizers", BeEmpty()))
+	})
+
+	It("should re-announce the routes when the address of the node changes", func(ctx SpecContext) {
+		createLoadBalancerService(ctx, ns.Name, []string{"192.0.2.11"})
+		Eventually(serverRoutes.Routes).Should(ContainElement(standardRoute(defaultVNI, "192.0.2.11")))
+
+		By("changing the address of the node")
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}
+		Eventually(UpdateStatus(node, func() {
+			node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "2001:db8:ff::3"}}
+		})).Should(Succeed())
+		DeferCleanup(UpdateStatus(node, func() {
+			node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: nodeIP}}
+		}))
+
+		Eventually(serverRoutes.Routes).Should(SatisfyAll(
+			ContainElement(hostRoute(defaultVNI, "192.0.2.11", metalbond.NextHop{
+				TargetAddress: netip.MustParseAddr("2001:db8:ff::3"),
+				TargetVNI:     defaultVNI,
+				Type:          pb.NextHopType_STANDARD,
+			})),
+			Not(ContainElement(standardRoute(defaultVNI, "192.0.2.11"))),
+		))
+	})
+
+	It("should announce the Services of a namespace in the VNI of its VNIMapping", func(ctx SpecContext) {
+		createVNIMapping(ctx, metalloadbalancerv1alpha1.VNIMappingSpec{Namespaces: []string{ns.Name}, VNI: 200})
+		createLoadBalancerService(ctx, ns.Name, []string{"192.0.2.12"})
+
+		Eventually(serverRoutes.Routes).Should(ContainElement(standardRoute(200, "192.0.2.12")))
+		Expect(serverRoutes.Routes()).NotTo(ContainElement(standardRoute(defaultVNI, "192.0.2.12")))
+	})
+
+	Context("next hop types", func() {
+		nodeNextHop := func(nextHopType pb.NextHopType) metalbond.NextHop {
+			return metalbond.NextHop{TargetAddress: netip.MustParseAddr(nodeIP), TargetVNI: defaultVNI, Type: nextHopType}
+		}
+
+		It("should announce the next hop type of the Service annotations", func(ctx SpecContext) {
+			service := createLoadBalancerService(ctx, ns.Name, []string{"192.0.2.13"}, func(service *corev1.Service) {
+				service.Annotations = map[string]string{
+					metalloadbalancerv1alpha1.ServiceNextHopTypeAnnotation:  string(metalloadbalancerv1alpha1.NextHopTypeNAT),
+					metalloadbalancerv1alpha1.ServiceNATPortRangeAnnotation: "1024-2047",
+				}
+			})
+			natNextHop := nodeNextHop(pb.NextHopType_NAT)
+			natNextHop.NATPortRangeFrom, natNextHop.NATPortRangeTo = 1024, 2047
+			Eventually(serverRoutes.Routes).Should(ContainElement(hostRoute(defaultVNI, "192.0.2.13", natNextHop)))
+
+			By("changing the next hop type")
+			Eventually(Update(service, func() {
+				service.Annotations = map[string]string{
+					metalloadbalancerv1alpha1.ServiceNextHopTypeAnnotation: string(metalloadbalancerv1alpha1.NextHopTypeLoadBalancerTarget),
+				}
+			})).Should(Succeed())
+			Eventually(serverRoutes.Routes).Should(SatisfyAll(
+				ContainElement(hostRoute(defaultVNI, "192.0.2.13", nodeNextHop(pb.NextHopType_LOADBALANCER_TARGET))),
+				Not(ContainElement(hostRoute(defaultVNI, "192.0.2.13", natNextHop))),
+			))
+		})
+
+		It("should announce the next hop type of the LoadBalancerIPPool", func(ctx SpecContext) {
+			pool := createPool(ctx, "192.0.2.0/24")
+			pool.Spec.NextHop = &metalloadbalancerv1alpha1.NextHop{Type: metalloadbalancerv1alpha1.NextHopTypeLoadBalancerTarget}
+			Expect(k8sClient.Update(ctx, pool)).To(Succeed())
+			service := createLoadBalancerService(ctx, ns.Name, nil)
+
+			By("allocating an address of the pool")
+			Eventually(UpdateStatus(pool, func() {
+				pool.Status.Allocations = []metalloadbalancerv1alpha1.IPAllocation{{
+					IP: "192.0.2.14",
+					ServiceRef: metalloadbalancerv1alpha1.ServiceReference{
+						Namespace: service.Namespace,
+						Name:      service.Name,
+						UID:       service.UID,
+					},
+				}}
+			})).Should(Succeed())
+			setIngress(service, "192.0.2.14")
+
+			Eventually(serverRoutes.Routes).Should(ContainElement(
+				hostRoute(defaultVNI, "192.0.2.14", nodeNextHop(pb.NextHopType_LOADBALANCER_TARGET)),
+			))
+		})
+	})
+
+	Context("conditions and events", func() {
+		It("should report whether the Service is announced", func(ctx SpecContext) {
+			service := createLoadBalancerService(ctx, ns.Name, nil)
+			Eventually(Object(service)).Should(HaveField("Status.Conditions", ContainElement(SatisfyAll(
+				HaveField("Type", metalloadbalancerv1alpha1.ServiceAnnouncedCondition),
+				HaveField("Status", metav1.ConditionFalse),
+				HaveField("Reason", "Pending"),
+			))))
+
+			By("publishing an ingress IP")
+			setIngress(service, "192.0.2.17")
+			Eventually(Object(service)).Should(HaveField("Status.Conditions", ContainElements(
+				SatisfyAll(
+					HaveField("Type", metalloadbalancerv1alpha1.ServiceAnnouncedCondition),
+					HaveField("Status", metav1.ConditionTrue),
+					HaveField("Reason", "Announced"),
+				),
+				SatisfyAll(
+					HaveField("Type", metalloadbalancerv1alpha1.ServiceAnnouncementFailedCondition),
+					HaveField("Status", metav1.ConditionFalse),
+				),
+			)))
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(service, "Announced"))
+
+			By("removing the ingress IP")
+			setIngress(service)
+			Eventually(Object(service)).Should(HaveField("Status.Conditions", ContainElement(SatisfyAll(
+				HaveField("Type", metalloadbalancerv1alpha1.ServiceAnnouncedCondition),
+				HaveField("Status", metav1.ConditionFalse),
+				HaveField("Reason", "NotAnnounced"),
+			))))
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(service, "Withdrawn"))
+		})
+	})
+
+	Context("metalbond sessions", func() {
+		It("should re-announce the routes once the session is re-established", func(ctx SpecContext) {
+			service := createLoadBalancerService(ctx, ns.Name, []string{"192.0.2.5"})
+			Eventually(serverRoutes.Routes).Should(ContainElement(standardRoute(defaultVNI, "192.0.2.5")))
+
+			By("restarting the metalbond server")
+			stopServer()
+			Eventually(peers[0].CheckEstablished).ShouldNot(Succeed())
+			serverRoutes = &routeRecorder{}
+			stopServer = startMetalBondServer(serverAddr, serverRoutes)
+
+			Eventually(peers[0].CheckEstablished).Should(Succeed())
+			Eventually(serverRoutes.Routes).Should(ContainElement(standardRoute(defaultVNI, "192.0.2.5")))
+			announcement := &metalloadbalancerv1alpha1.ServiceAnnouncement{ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      ServiceAnnouncementName(service.Name, nodeName),
+			}}
+			Eventually(Object(announcement)).Should(HaveField("Status.Peers", ConsistOf(SatisfyAll(
+				HaveField("Server", serverAddr),
+				HaveField("State", "ESTABLISHED"),
+			))))
+		})
+	})
+
+	Context("externalTrafficPolicy Local", func() {
+		It("should only announce while the node has a ready local endpoint", func(ctx SpecContext) {
+			service := createLoadBalancerService(ctx, ns.Name, []string{"192.0.2.8"}, func(service *corev1.Service) {
+				service.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyLocal
+			})
+			Consistently(serverRoutes.Routes).ShouldNot(ContainElement(standardRoute(defaultVNI, "192.0.2.8")))
+
+			By("adding a ready endpoint on another node")
+			endpointSlice := &discoveryv1.EndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:    ns.Name,
+					GenerateName: service.Name + "-",
+					Labels:       map[string]string{discoveryv1.LabelServiceName: service.Name},
+				},
+				AddressType: discoveryv1.AddressTypeIPv4,
+				Endpoints: []discoveryv1.Endpoint{{
+					Addresses:  []string{"10.0.0.1"},
+					Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)},
+					NodeName:   ptr.To("other-node"),
+				}},
+			}
+			Expect(k8sClient.Create(ctx, endpointSlice)).To(Succeed())
+			DeferCleanup(func(ctx context.Context) error {
+				return client.IgnoreNotFound(k8sClient.Delete(ctx, endpointSlice))
+			})
+			Consistently(serverRoutes.Routes).ShouldNot(ContainElement(standardRoute(defaultVNI, "192.0.2.8")))
+
+			By("adding a ready endpoint on the node")
+			Eventually(Update(endpointSlice, func() {
+				endpointSlice.Endpoints = append(endpointSlice.Endpoints, discoveryv1.Endpoint{
+					Addresses:  []string{"10.0.0.2"},
+					Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)},
+					NodeName:   ptr.To(nodeName),
+				})
+			})).Should(Succeed())
+			Eventually(serverRoutes.Routes).Should(ContainElement(standardRoute(defaultVNI, "192.0.2.8")))
+
+			By("making the local endpoint unready")
+			Eventually(Update(endpointSlice, func() {
+				endpointSlice.Endpoints[1].Conditions.Ready = ptr.To(false)
+			})).Should(Succeed())
+			Eventually(serverRoutes.Routes).ShouldNot(ContainElement(standardRoute(defaultVNI, "192.0.2.8")))
+			Eventually(Object(service)).Should(HaveField("Finalizers", BeEmpty()))
+		})
+	})
+
+	Context("node selectors", func() {
+		It("should only announce while the node matches the node selector of the Service", func(ctx SpecContext) {
+			createLoadBalancerService(ctx, ns.Name, []string{"192.0.2.9"}, func(service *corev1.Service) {
+				service.Annotations = map[string]string{metalloadbalancerv1alpha1.ServiceNodeSelectorAnnotation: "role=edge"}
+			})
+			Consistently(serverRoutes.Routes).ShouldNot(ContainElement(standardRoute(defaultVNI, "192.0.2.9")))
+
+			By("labeling the node")
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}
+			Eventually(Update(node, func() {
+				node.Labels = map[string]string{"role": "edge"}
+			})).Should(Succeed())
+			DeferCleanup(Update(node, func() {
+				delete(node.Labels, "role")
+			}))
+			Eventually(serverRoutes.Routes).Should(ContainElement(standardRoute(defaultVNI, "192.0.2.9")))
+
+			By("removing the label of the node")
+			Eventually(Update(node, func() {
+				delete(node.Labels, "role")
+			})).Should(Succeed())
+			Eventually(serverRoutes.Routes).ShouldNot(ContainElement(standardRoute(defaultVNI, "192.0.2.9")))
+		})
+
+		It("should report an invalid node selector annotation", func(ctx SpecContext) {
+			service := createLoadBalancerService(ctx, ns.Name, []string{"192.0.2.10"}, func(service *corev1.Service) {
+				service.Annotations = map[string]string{metalloadbalancerv1alpha1.ServiceNodeSelectorAnnotation: "role in ("}
+			})
+
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(service, "InvalidAnnotation"))
+			Eventually(Object(service)).Should(HaveField("Status.Conditions", ContainElement(SatisfyAll(
+				HaveField("Type", metalloadbalancerv1alpha1.ServiceAnnouncementFailedCondition),
+				HaveField("Status", metav1.ConditionTrue),
+				HaveField("Reason", "InvalidAnnotation"),
+			))))
+			Consistently(serverRoutes.Routes).ShouldNot(ContainElement(standardRoute(defaultVNI, "192.0.2.10")))
+		})
+	})
+
+	Context("external IPs", func() {
+		It("should not announce external IPs outside of the LoadBalancerIPPools", func(ctx SpecContext) {
+			service := createLoadBalancerService(ctx, ns.Name, []string{"192.0.2.4"}, func(service *corev1.Service) {
+				service.Spec.ExternalIPs = []string{"198.51.100.1"}
+			})
+
+			Eventually(serverRoutes.Routes).Should(ContainElement(standardRoute(defaultVNI, "192.0.2.4")))
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(service, "ExternalIPNotAllowed"))
+			Consistently(serverRoutes.Routes).ShouldNot(ContainElement(standardRoute(defaultVNI, "198.51.100.1")))
+		})
+
+		It("should withdraw external IPs once they are allocated to another Service", func(ctx SpecContext) {
+			pool := createPool(ctx, "198.51.100.0/24")
+			service := createLoadBalancerService(ctx, ns.Name, nil, func(service *corev1.Service) {
+				service.Spec.ExternalIPs = []string{"198.51.100.2"}
+			})
+			Eventually(serverRoutes.Routes).Should(ContainElement(standardRoute(defaultVNI, "198.51.100.2")))
+
+			By("allocating the external IP to another Service")
+			Eventually(UpdateStatus(pool, func() {
+				pool.Status.Allocations = []metalloadbalancerv1alpha1.IPAllocation{{
+					IP:         "198.51.100.2",
+					ServiceRef: metalloadbalancerv1alpha1.ServiceReference{Namespace: ns.Name, Name: "other", UID: "other"},
+				}}
+			})).Should(Succeed())
+			Eventually(serverRoutes.Routes).ShouldNot(ContainElement(standardRoute(defaultVNI, "198.51.100.2")))
+			Eventually(ObjectList(&eventsv1.EventList{}, client.InNamespace(ns.Name))).Should(haveEvent(service, "ExternalIPNotAllowed"))
+		})
+	})
+
+	It("should withdraw the routes of a Service that is no longer a LoadBalancer", func(ctx SpecContext) {
+		service := createLoadBalancerService(ctx, ns.Name, []string{"192.0.2.2"})
+		Eventually(serverRoutes.Routes).Should(ContainElement(standardRoute(defaultVNI, "192.0.2.2")))
+		announcement := &metalloadbalancerv1alpha1.ServiceAnnouncement{ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns.Name,
+			Name:      ServiceAnnouncementName(service.Name, nodeName),
+		}}
+		Eventually(Get(announcement)).Should(Succeed())
+
+		By("changing the Service to a ClusterIP Service")
+		Eventually(Update(service, func() {
+			service.Spec.Type = corev1.ServiceTypeClusterIP
+		})).Should(Succeed())
+
+		By("withdrawing the route and removing the finalizer")
+		Eventually(serverRoutes.Routes).ShouldNot(ContainElement(standardRoute(defaultVNI, "192.0.2.2")))
+		Eventually(Object(service)).Should(HaveField("Finalizers", Not(ContainElement(NodeFinalizer(nodeName)))))
+		Eventually(Get(announcement)).Should(Satisfy(apierrors.IsNotFound))
+	})
+})
+
+// createPool creates a LoadBalancerIPPool with the given CIDRs, which is deleted at the end of the spec.
+func createPool(ctx context.Context, cidrs ...string) *metalloadbalancerv1alpha1.LoadBalancerIPPool {
+	pool := &metalloadbalancerv1alpha1.LoadBalancerIPPool{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "pool-"},
+		Spec:       metalloadbalancerv1alpha1.LoadBalancerIPPoolSpec{CIDRs: cidrs},
+	}
+	Expect(k8sClient.Create(ctx, pool)).To(Succeed())
+	DeferCleanup(func(ctx context.Context) error {
+		return client.IgnoreNotFound(k8sClient.Delete(ctx, pool))
+	})
+	return pool
+}
+
+// createVNIMapping creates a VNIMapping with the given spec, which is deleted at the end of the spec.
+func createVNIMapping(ctx context.Context, spec metalloadbalancerv1alpha1.VNIMappingSpec) *metalloadbalancerv1alpha1.VNIMapping {
+	mapping := &metalloadbalancerv1alpha1.VNIMapping{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "mapping-"},
+		Spec:       spec,
+	}
+	Expect(k8sClient.Create(ctx, mapping)).To(Succeed())
+	DeferCleanup(func(ctx context.Context) error {
+		return client.IgnoreNotFound(k8sClient.Delete(ctx, mapping))
+	})
+	return mapping
+}
+
+// createLoadBalancerService creates a LoadBalancer Service in the namespace with the given ingress IPs after
+// applying the given mutations. The Service is deleted at the end of the spec, and the spec waits until its
+// finalizers are removed.
+func createLoadBalancerService(ctx context.Context, namespace string, ingressIPs []string, mutate ...func(*corev1.Service)) *corev1.Service {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:    namespace,
+			GenerateName: "service-",
+		},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{{Name: "http", Port: 80}},
+		},
+	}
+	for _, f := range mutate {
+		f(service)
+	}
+	Expect(k8sClient.Create(ctx, service)).To(Succeed())
+	DeferCleanup(func(ctx context.Context) {
+		Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, service))).To(Succeed())
+		Eventually(Get(service)).Should(Satisfy(apierrors.IsNotFound))
+	})
+
+	if len(ingressIPs) > 0 {
+		setIngress(service, ingressIPs...)
+	}
+	return service
+}
+
+// setIngress publishes the given IPs in the LoadBalancer status of the Service, as the controller does.
+func setIngress(service *corev1.Service, ips ...string) {
+	GinkgoHelper()
+	Eventually(UpdateStatus(service, func() {
+		service.Status.LoadBalancer.Ingress = nil
+		for _, ip := range ips {
+			service.Status.LoadBalancer.Ingress = append(service.Status.LoadBalancer.Ingress, corev1.LoadBalancerIngress{IP: ip})
+		}
+	})).Should(Succeed())
+}
+
+// haveEvent matches an EventList containing an event with the given reason regarding the Service.
+func haveEvent(service *corev1.Service, reason string) gomegatypes.GomegaMatcher {
+	return HaveField("Items", ContainElement(SatisfyAll(
+		HaveField("Regarding.UID", service.UID),
+		HaveField("Reason", reason),
+	)))
+}
+
+// standardRoute returns the host route of the given IP in the VNI with the node as standard next hop.
+func standardRoute(vni metalbond.VNI, ip string) Route {
+	return hostRoute(vni, ip, metalbond.NextHop{
+		TargetAddress: netip.MustParseAddr(nodeIP),
+		TargetVNI:     uint32(vni),
+		Type:          pb.NextHopType_STANDARD,
+	})
+}
+
+// hostRoute returns the host route of the given IP in the VNI via the next hop.
+func hostRoute(vni metalbond.VNI, ip string, nextHop metalbond.NextHop) Route {
+	addr := netip.MustParseAddr(ip)
+	return prefixRoute(vni, netip.PrefixFrom(addr, addr.BitLen()).String(), nextHop)
+}
+
+// prefixRoute returns the route of the given prefix in the VNI via the next hop.
+func prefixRoute(vni metalbond.VNI, prefix string, nextHop metalbond.NextHop) Route {
+	p := netip.MustParsePrefix(prefix)
+	ipVersion := metalbond.IPV6
+	if p.Addr().Is4() {
+		ipVersion = metalbond.IPV4
+	}
+	return Route{
+		VNI:     vni,
+		Dest:    metalbond.Destination{IPVersion: ipVersion, Prefix: p},
+		NextHop: nextHop,
+	}
+}
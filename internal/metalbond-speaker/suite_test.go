@@ -6,15 +6,22 @@ package metalbondspeaker
 import (
 	"context"
 	"fmt"
+	"math"
+	"net"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	"github.com/ironcore-dev/metalbond"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -32,10 +39,28 @@ const (
 	consistentlyDuration = 1 * time.Second
 )
 
+const (
+	// defaultVNI is the VNI the speaker of the suite announces Services in by default.
+	defaultVNI = 100
+	// nodeName is the name of the node the speaker of the suite runs on.
+	nodeName = "node"
+	// nodeIP is the InternalIP of the node, which is announced as next hop.
+	nodeIP = "2001:db8:ff::1"
+)
+
 var (
-	cfg       *rest.Config
-	k8sClient client.Client
-	testEnv   *envtest.Environment
+	cfg        *rest.Config
+	k8sClient  client.Client
+	k8sManager ctrl.Manager
+	testEnv    *envtest.Environment
+
+	// serverAddr is the address of the metalbond server the speaker of the suite connects to, serverRoutes
+	// records the routes the server received and stopServer shuts it down.
+	serverAddr   string
+	serverRoutes *routeRecorder
+	stopServer   func()
+	peers        []Peer
+	reconciler   *ServiceReconciler
 )
 
 func TestControllers(t *testing.T) {
@@ -53,6 +78,9 @@ var _ = BeforeSuite(func() {
 
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
+		ErrorIfCRDPathMissing: true,
+
 		// The BinaryAssetsDirectory is only required if you want to run the tests directly
 		// without call the makefile target test. If not informed it will look for the
 		// default path defined in controller-runtime which is /usr/local/kubebuilder/.
@@ -71,6 +99,7 @@ var _ = BeforeSuite(func() {
 	DeferCleanup(testEnv.Stop)
 
 	Expect(corev1.AddToScheme(scheme.Scheme)).NotTo(HaveOccurred())
+	Expect(metalloadbalancerv1alpha1.AddToScheme(scheme.Scheme)).NotTo(HaveOccurred())
 
 	// +kubebuilder:scaffold:scheme
 
@@ -85,15 +114,65 @@ var _ = BeforeSuite(func() {
 	mgrCtx, cancel := context.WithCancel(context.Background())
 	DeferCleanup(cancel)
 
-	k8sManager, err := ctrl.NewManager(cfg, ctrl.Options{
+	By("starting a metalbond server")
+	// Reconnect quickly, so that the specs do not wait long for the session.
+	metalbond.RetryIntervalMin, metalbond.RetryIntervalMax = 1, 1
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	serverAddr = listener.Addr().String()
+	Expect(listener.Close()).To(Succeed())
+	serverRoutes = &routeRecorder{}
+	stopServer = startMetalBondServer(serverAddr, serverRoutes)
+	DeferCleanup(func() { stopServer() })
+
+	By("creating the node of the speaker")
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}
+	Expect(k8sClient.Create(context.Background(), node)).To(Succeed())
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: nodeIP}}
+	Expect(k8sClient.Status().Update(context.Background(), node)).To(Succeed())
+
+	k8sManager, err = ctrl.NewManager(cfg, ctrl.Options{
 		Scheme: scheme.Scheme,
 	})
 	Expect(err).ToNot(HaveOccurred())
 
+	peers = NewPeers([]string{serverAddr}, metalbond.Config{KeepaliveInterval: 1})
+	for _, peer := range peers {
+		Expect(k8sManager.Add(&Connector{
+			Peer: peer,
+			VNI:  defaultVNI,
+			Backoff: wait.Backoff{
+				Duration: 100 * time.Millisecond,
+				Factor:   1,
+				Steps:    math.MaxInt32,
+			},
+		})).To(Succeed())
+	}
+
+	reconciler = &ServiceReconciler{
+		Client:              k8sManager.GetClient(),
+		Scheme:              k8sManager.GetScheme(),
+		Recorder:            k8sManager.GetEventRecorder("metalbond-speaker"),
+		VNI:                 defaultVNI,
+		Peers:               peers,
+		NodeName:            nodeName,
+		NodeAddressSelector: NodeAddressSelector{Types: DefaultNodeAddressTypes, Family: corev1.IPv6Protocol},
+		Routes:              NewAnnouncedRoutes(),
+		// Collect orphaned routes quickly, so that the specs do not need to wait for them.
+		RouteGCInterval: time.Second,
+	}
+	Expect(reconciler.SetupWithManager(k8sManager)).To(Succeed())
+
 	go func() {
 		defer GinkgoRecover()
 		Expect(k8sManager.Start(mgrCtx)).To(Succeed(), "failed to start manager")
 	}()
+
+	Eventually(peers[0].CheckEstablished).Should(Succeed())
+
+	// Informers are started on first use, which would delay the reconciliations of the first spec.
+	_, err = k8sManager.GetCache().GetInformer(mgrCtx, &metalloadbalancerv1alpha1.ServiceAnnouncement{})
+	Expect(err).NotTo(HaveOccurred())
 })
 
 func SetupTest() *corev1.Namespace {
@@ -111,3 +190,41 @@ func SetupTest() *corev1.Namespace {
 
 	return ns
 }
+
+// startMetalBondServer starts a metalbond server listening on the given address, which hands the routes it
+// receives to the given client. It returns a function shutting the server down.
+func startMetalBondServer(addr string, client metalbond.Client) func() {
+	server := metalbond.NewMetalBond(metalbond.Config{KeepaliveInterval: 1}, client)
+	Expect(server.StartServer(addr)).To(Succeed())
+	return server.Shutdown
+}
+
+// routeRecorder is a metalbond.Client recording the routes a metalbond server received.
+type routeRecorder struct {
+	mu     sync.Mutex
+	routes sets.Set[Route]
+}
+
+func (r *routeRecorder) AddRoute(vni metalbond.VNI, dest metalbond.Destination, nextHop metalbond.NextHop) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.routes == nil {
+		r.routes = sets.New[Route]()
+	}
+	r.routes.Insert(Route{VNI: vni, Dest: dest, NextHop: nextHop})
+	return nil
+}
+
+func (r *routeRecorder) RemoveRoute(vni metalbond.VNI, dest metalbond.Destination, nextHop metalbond.NextHop) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes.Delete(Route{VNI: vni, Dest: dest, NextHop: nextHop})
+	return nil
+}
+
+// Routes returns the recorded routes.
+func (r *routeRecorder) Routes() []Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.routes.UnsortedList()
+}
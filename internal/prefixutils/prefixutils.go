@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package prefixutils
+
+import (
+	"net/netip"
+)
+
+// Parse parses the given CIDRs into masked prefixes. Plain addresses are treated as single-address prefixes.
+func Parse(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if addr, err := netip.ParseAddr(value); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Subtract returns the smallest set of prefixes covering the addresses of the given prefix that are not within
+// any of the exclusions, in ascending order.
+func Subtract(prefix netip.Prefix, exclusions []netip.Prefix) []netip.Prefix {
+	prefix = prefix.Masked()
+	overlaps := false
+	for _, exclusion := range exclusions {
+		if !exclusion.Overlaps(prefix) {
+			continue
+		}
+		if exclusion.Bits() <= prefix.Bits() {
+			return nil
+		}
+		overlaps = true
+	}
+	if !overlaps {
+		return []netip.Prefix{prefix}
+	}
+
+	lower, upper := split(prefix)
+	return append(Subtract(lower, exclusions), Subtract(upper, exclusions)...)
+}
+
+// split splits the given prefix into its two halves. The prefix must not be a single address.
+func split(prefix netip.Prefix) (netip.Prefix, netip.Prefix) {
+	bits := prefix.Bits()
+	lower := netip.PrefixFrom(prefix.Addr(), bits+1)
+
+	upperAddr := prefix.Addr().AsSlice()
+	upperAddr[bits/8] |= 0x80 >> (bits % 8)
+	addr, _ := netip.AddrFromSlice(upperAddr)
+	return lower, netip.PrefixFrom(addr, bits+1)
+}
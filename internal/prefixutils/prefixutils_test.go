@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package prefixutils
+
+import (
+	"net/netip"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParse(t *testing.T) {
+	g := NewWithT(t)
+	prefixes, err := Parse([]string{"192.0.2.1", "192.0.2.17/28", "2001:db8::1"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(prefixes).To(Equal([]netip.Prefix{
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("192.0.2.16/28"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+	}))
+
+	_, err = Parse([]string{"192.0.2.0/33"})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestSubtract(t *testing.T) {
+	for name, tc := range map[string]struct {
+		prefix     string
+		exclusions []string
+		want       []string
+	}{
+		"no exclusions": {
+			prefix: "192.0.2.0/24",
+			want:   []string{"192.0.2.0/24"},
+		},
+		"unrelated exclusion": {
+			prefix:     "192.0.2.0/24",
+			exclusions: []string{"198.51.100.0/24", "2001:db8::/64"},
+			want:       []string{"192.0.2.0/24"},
+		},
+		"excluded entirely": {
+			prefix:     "192.0.2.0/24",
+			exclusions: []string{"192.0.0.0/16"},
+		},
+		"single address": {
+			prefix:     "192.0.2.0/30",
+			exclusions: []string{"192.0.2.0/32"},
+			want:       []string{"192.0.2.1/32", "192.0.2.2/31"},
+		},
+		"overlapping exclusions": {
+			prefix:     "192.0.2.0/24",
+			exclusions: []string{"192.0.2.0/25", "192.0.2.0/26", "192.0.2.192/26"},
+			want:       []string{"192.0.2.128/26"},
+		},
+		"ipv6": {
+			prefix:     "2001:db8::/126",
+			exclusions: []string{"2001:db8::3/128"},
+			want:       []string{"2001:db8::/127", "2001:db8::2/128"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			g := NewWithT(t)
+			var exclusions []netip.Prefix
+			for _, exclusion := range tc.exclusions {
+				exclusions = append(exclusions, netip.MustParsePrefix(exclusion))
+			}
+			var got []string
+			for _, prefix := range Subtract(netip.MustParsePrefix(tc.prefix), exclusions) {
+				got = append(got, prefix.String())
+			}
+			g.Expect(got).To(Equal(tc.want))
+		})
+	}
+}
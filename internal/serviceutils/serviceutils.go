@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceutils
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	metalloadbalancerv1alpha1 "github.com/ironcore-dev/metal-load-balancer-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// NodeFinalizerPrefix is the prefix of the finalizers the speaker of each node adds to the Services it announces.
+const NodeFinalizerPrefix = "speaker.metal-loadbalancer.ironcore.dev/"
+
+// HasNodeFinalizers reports whether a speaker may still announce the given Service.
+func HasNodeFinalizers(service *corev1.Service) bool {
+	return slices.ContainsFunc(service.Finalizers, func(finalizer string) bool {
+		return strings.HasPrefix(finalizer, NodeFinalizerPrefix)
+	})
+}
+
+// MatchesLoadBalancerClass reports whether the given Service is handled by the given load balancer class.
+// Services without spec.loadBalancerClass are matched if class is empty or includeWithoutClass is set.
+func MatchesLoadBalancerClass(service *corev1.Service, class string, includeWithoutClass bool) bool {
+	if service.Spec.LoadBalancerClass == nil {
+		return class == "" || includeWithoutClass
+	}
+	return *service.Spec.LoadBalancerClass == class
+}
+
+// HasOtherLoadBalancerClass reports whether the given Service has a spec.loadBalancerClass other than the given
+// class. As the class of a Service is immutable, such Services belong to another load balancer implementation or
+// another instance of this one and must not be touched, even if they carry finalizers of the same name.
+func HasOtherLoadBalancerClass(service *corev1.Service, class string) bool {
+	return service.Spec.LoadBalancerClass != nil && *service.Spec.LoadBalancerClass != class
+}
+
+// PatchEnsureFinalizer works like clientutils.PatchEnsureFinalizer but uses optimistic locking, as the
+// finalizers of a Service are modified concurrently by the controller and the speakers of all nodes.
+func PatchEnsureFinalizer(ctx context.Context, c client.Client, obj client.Object, finalizer string) (modified bool, err error) {
+	if controllerutil.ContainsFinalizer(obj, finalizer) {
+		return false, nil
+	}
+
+	baseObj := obj.DeepCopyObject().(client.Object)
+	controllerutil.AddFinalizer(obj, finalizer)
+	if err := c.Patch(ctx, obj, client.MergeFromWithOptions(baseObj, client.MergeFromWithOptimisticLock{})); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PatchEnsureNoFinalizers removes the given finalizers from the object with a single optimistically locked
+// patch. The modified result reports whether the object had to be modified.
+func PatchEnsureNoFinalizers(ctx context.Context, c client.Client, obj client.Object, finalizers ...string) (modified bool, err error) {
+	baseObj := obj.DeepCopyObject().(client.Object)
+	for _, finalizer := range finalizers {
+		if controllerutil.RemoveFinalizer(obj, finalizer) {
+			modified = true
+		}
+	}
+	if !modified {
+		return false, nil
+	}
+
+	if err := c.Patch(ctx, obj, client.MergeFromWithOptions(baseObj, client.MergeFromWithOptimisticLock{})); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PatchServiceCondition sets the given condition on the Service. The patch uses optimistic locking, as the
+// conditions of a Service are modified concurrently by the controller and the speakers of all nodes.
+func PatchServiceCondition(ctx context.Context, c client.Client, service *corev1.Service, condition metav1.Condition) (modified bool, err error) {
+	baseService := service.DeepCopy()
+	condition.ObservedGeneration = service.Generation
+	if !meta.SetStatusCondition(&service.Status.Conditions, condition) {
+		return false, nil
+	}
+
+	if err := c.Status().Patch(ctx, service, client.MergeFromWithOptions(baseService, client.MergeFromWithOptimisticLock{})); err != nil {
+		return false, fmt.Errorf("failed to patch %s condition: %w", condition.Type, err)
+	}
+	return true, nil
+}
+
+// GetVNIMapping returns the VNIMapping of the namespace of the given Service, or nil if the namespace is not
+// mapped. If several VNIMappings match the namespace, the first one by name is returned.
+func GetVNIMapping(ctx context.Context, c client.Reader, service *corev1.Service) (*metalloadbalancerv1alpha1.VNIMapping, error) {
+	mappingList := &metalloadbalancerv1alpha1.VNIMappingList{}
+	if err := c.List(ctx, mappingList); err != nil {
+		return nil, fmt.Errorf("failed to list VNIMappings: %w", err)
+	}
+	if len(mappingList.Items) == 0 {
+		return nil, nil
+	}
+
+	namespace := &corev1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: service.Namespace}, namespace); err != nil {
+		return nil, fmt.Errorf("failed to get Namespace %s: %w", service.Namespace, err)
+	}
+
+	mappings := mappingList.Items
+	slices.SortFunc(mappings, func(a, b metalloadbalancerv1alpha1.VNIMapping) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	for i := range mappings {
+		mapping := &mappings[i]
+		if slices.Contains(mapping.Spec.Namespaces, namespace.Name) {
+			return mapping, nil
+		}
+		if mapping.Spec.NamespaceSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(mapping.Spec.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace selector of VNIMapping %s: %w", mapping.Name, err)
+		}
+		if selector.Matches(labels.Set(namespace.Labels)) {
+			return mapping, nil
+		}
+	}
+	return nil, nil
+}